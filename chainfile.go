@@ -0,0 +1,263 @@
+package rainbow
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Chain file layout (all integers are little endian) :
+//
+//	magic      4 bytes, "RBWC"
+//	version    uint32
+//	hsize      uint32, size of the hash in bytes
+//	seed       uint64, seed of the chain starts, see seededStart
+//	siglen     uint64, length of the signature
+//	signature  siglen bytes
+//	blocks     zero or more blocks, each made of :
+//	   nb         uint32, number of chains in the block
+//	   records    nb unsorted chain records (start then end)
+//	   checkpoint uint64, total number of chains generated so far
+//
+// A chain file is append only. A block is only valid once its checkpoint
+// is fully written, so an interrupted run loses at most one block.
+
+// magic bytes identifying a chain file
+var chainFileMagic = [4]byte{'R', 'B', 'W', 'C'}
+
+// current version of the chain file format
+const chainFileVersion = 2
+
+// chainFile is an open, append only, chain file.
+type chainFile struct {
+	f    *os.File
+	seed uint64
+	// total number of chains in the valid blocks
+	total uint64
+	// index of the next chain start
+	next uint64
+}
+
+// writeChainFileHeader writes a fresh chain file header for r.
+func (r *Rainbow) writeChainFileHeader(w io.Writer, seed uint64) error {
+	buf := new(bytes.Buffer)
+	buf.Write(chainFileMagic[:])
+	binary.Write(buf, mode, uint32(chainFileVersion))
+	binary.Write(buf, mode, uint32(r.hsize))
+	binary.Write(buf, mode, seed)
+	binary.Write(buf, mode, uint64(len(r.signature)))
+	buf.WriteString(r.signature)
+	_, e := w.Write(buf.Bytes())
+	return e
+}
+
+// readChainFileHeader reads and checks the chain file header,
+// returning the seed of the chain starts.
+func (r *Rainbow) readChainFileHeader(rd io.Reader) (seed uint64, err error) {
+	fixed := make([]byte, 4+4+4+8+8)
+	if _, err = io.ReadFull(rd, fixed); err != nil {
+		return 0, readError(err, "reading chain file header")
+	}
+	if !bytes.Equal(fixed[0:4], chainFileMagic[:]) {
+		return 0, errorf(ErrBadMagic, "expected %q", chainFileMagic[:])
+	}
+	if v := mode.Uint32(fixed[4:8]); v != chainFileVersion {
+		return 0, errorf(ErrBadVersion, "chain file version %d", v)
+	}
+	if int(mode.Uint32(fixed[8:12])) != r.hsize {
+		return 0, errorf(ErrSignatureMismatch, "cannot load, record sizes differ")
+	}
+	seed = mode.Uint64(fixed[12:20])
+	sl := mode.Uint64(fixed[20:28])
+	if sl != uint64(len(r.signature)) {
+		return 0, errorf(ErrSignatureMismatch, "cannot load")
+	}
+	sig := make([]byte, sl)
+	if _, err = io.ReadFull(rd, sig); err != nil {
+		return 0, readError(err, "reading signature")
+	}
+	if !r.checkSignature(string(sig)) {
+		return 0, errorf(ErrSignatureMismatch, "cannot load")
+	}
+	return seed, nil
+}
+
+// scanChainFile reads the valid blocks of a chain file, after its header,
+// calling add for each chain found if add is not nil.
+// It returns the number of chains and the number of bytes in the valid blocks.
+// An incomplete or inconsistent trailing block is silently ignored.
+// Records are read one by one, so the block sizes declared in the file
+// are never trusted for allocation.
+func (r *Rainbow) scanChainFile(rd io.Reader, add func(c *Chain)) (total uint64, size int64) {
+	buf := bufio.NewReader(rd)
+	w := r.walker()
+	rs := w.recordSize()
+	for {
+		var nb uint32
+		if binary.Read(buf, mode, &nb) != nil {
+			return total, size
+		}
+		var block []*Chain
+		for i := uint32(0); i < nb; i++ {
+			rec := make([]byte, rs)
+			if _, e := io.ReadFull(buf, rec); e != nil {
+				return total, size
+			}
+			block = append(block, w.chainOf(rec))
+		}
+		var cp uint64
+		if binary.Read(buf, mode, &cp) != nil || cp != total+uint64(nb) {
+			return total, size
+		}
+		if add != nil {
+			for _, c := range block {
+				add(c)
+			}
+		}
+		total = cp
+		size += int64(4 + int(nb)*rs + 8)
+	}
+}
+
+// openChainFile opens, or creates, the chain file for r.
+// An existing file is validated, and truncated after its last valid block.
+func (r *Rainbow) openChainFile(fName string) (*chainFile, error) {
+	f, err := os.OpenFile(fName, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	cf := &chainFile{f: f}
+
+	if fi.Size() == 0 {
+		// fresh file
+		cf.seed = r.rand.Uint64()
+		if err = r.writeChainFileHeader(f, cf.seed); err != nil {
+			f.Close()
+			return nil, err
+		}
+		return cf, f.Sync()
+	}
+
+	// existing file, resume
+	if cf.seed, err = r.readChainFileHeader(f); err != nil {
+		f.Close()
+		return nil, err
+	}
+	hsz, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	var size int64
+	var last *Chain
+	cf.total, size = r.scanChainFile(f, func(c *Chain) { last = c })
+	if last != nil {
+		seed, index, ok := startIndex(last.start)
+		if !ok || seed != cf.seed {
+			f.Close()
+			return nil, errorf(ErrCorrupted, "last chain start was not derived from the file seed")
+		}
+		cf.next = index + 1
+	}
+	if err = f.Truncate(hsz + size); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if _, err = f.Seek(hsz+size, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return cf, nil
+}
+
+// appendBlock appends chains as a new block, followed by its checkpoint,
+// and syncs the file to stable storage.
+func (cf *chainFile) appendBlock(w *walker, chains []*Chain) error {
+	buf := bufio.NewWriter(cf.f)
+	binary.Write(buf, mode, uint32(len(chains)))
+	var rec []byte
+	for _, c := range chains {
+		rec = w.appendRecord(rec[:0], c)
+		buf.Write(rec)
+	}
+	binary.Write(buf, mode, cf.total+uint64(len(chains)))
+	if e := buf.Flush(); e != nil {
+		return e
+	}
+	if e := cf.f.Sync(); e != nil {
+		return e
+	}
+	cf.total += uint64(len(chains))
+	return nil
+}
+
+// Generate generates chains into the append only chain file fName,
+// until the file holds total chains.
+// Every 'every' chains, new chains are flushed to the file,
+// followed by a checkpoint.
+// If the file already exists, its signature is checked,
+// and generation resumes after the last valid checkpoint,
+// with the same sequence of chain starts.
+// Generated chains are not added to r, see LoadChainFile.
+func (r *Rainbow) Generate(fName string, total, every int) error {
+	if r.rf == nil {
+		return errors.New("cannot generate : the reduce function was not built yet")
+	}
+	if every <= 0 {
+		return errors.New("invalid checkpoint interval")
+	}
+
+	cf, err := r.openChainFile(fName)
+	if err != nil {
+		return err
+	}
+	defer cf.f.Close()
+
+	if cf.total > 0 {
+		fmt.Println("Resuming generation after", cf.total, "chains")
+	}
+
+	w := r.walker()
+	block := make([]*Chain, 0, every)
+	next := cf.next
+	for n := int(cf.total); n < total; n++ {
+		var c *Chain
+		c, next = r.newChain(cf.seed, next)
+		block = append(block, c)
+		if len(block) == every || n+1 == total {
+			if err = cf.appendBlock(&w, block); err != nil {
+				return err
+			}
+			block = block[:0]
+			fmt.Println(cf.total, "chains generated")
+		}
+	}
+	return nil
+}
+
+// LoadChainFile adds to r the chains from the valid blocks of
+// the chain file fName, produced by Generate.
+func (r *Rainbow) LoadChainFile(fName string) error {
+	f, err := os.Open(fName)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err = r.readChainFileHeader(f); err != nil {
+		return err
+	}
+	total, _ := r.scanChainFile(f, func(c *Chain) { r.AddChain(c) })
+	fmt.Println(total, "chains loaded")
+	return nil
+}
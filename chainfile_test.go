@@ -0,0 +1,104 @@
+package rainbow
+
+import (
+	"bytes"
+	"crypto"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGenerateResume(t *testing.T) {
+	dir := t.TempDir()
+	full := filepath.Join(dir, "full.rbc")
+	crashed := filepath.Join(dir, "crashed.rbc")
+
+	// uninterrupted run
+	if e := getTestRainbow(20).Generate(full, 100, 20); e != nil {
+		t.Fatal(e)
+	}
+	ref, _ := os.ReadFile(full)
+
+	// simulate a crash in the middle of the third block
+	hsz := len(ref) - 5*(4+20*32+8)
+	os.WriteFile(crashed, ref[:hsz+2*(4+20*32+8)+100], 0644)
+
+	// resume
+	if e := getTestRainbow(20).Generate(crashed, 100, 20); e != nil {
+		t.Fatal(e)
+	}
+	res, _ := os.ReadFile(crashed)
+	if !bytes.Equal(ref, res) {
+		t.Fatal("resumed generation differs from uninterrupted generation")
+	}
+
+	// resuming a completed file does nothing
+	if e := getTestRainbow(20).Generate(crashed, 100, 20); e != nil {
+		t.Fatal(e)
+	}
+	res, _ = os.ReadFile(crashed)
+	if !bytes.Equal(ref, res) {
+		t.Fatal("completed chain file was modified")
+	}
+
+	// chains are valid, and can be looked up
+	r := getTestRainbow(20)
+	if e := r.LoadChainFile(crashed); e != nil {
+		t.Fatal(e)
+	}
+	if len(r.chains) != 100 {
+		t.Fatalf("expected 100 chains, got %d", len(r.chains))
+	}
+	c := r.chains[42]
+	cc := getTestRainbow(20).chainFrom(append([]byte{}, c.start...))
+	if !c.Equal(cc) {
+		t.Fatal("loaded chain is inconsistent with its start")
+	}
+	psswd, h := r.getPHSample(c, 7)
+	if p, found := r.Lookup(h); !found || !bytes.Equal(r.hf(p, []byte{}), r.hf(psswd, []byte{})) {
+		t.Fatal("lookup failed on loaded chains")
+	}
+}
+
+func TestGenerateMismatch(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "mismatch.rbc")
+	if e := getTestRainbow(20).Generate(fname, 10, 5); e != nil {
+		t.Fatal(e)
+	}
+	rr := New(crypto.MD5, 20).CompileAlphabet("abc", 2, 3).Build()
+	if e := rr.Generate(fname, 20, 5); e == nil {
+		t.Fatal("resuming with a different signature should fail")
+	}
+	if e := rr.LoadChainFile(fname); e == nil {
+		t.Fatal("loading with a different signature should fail")
+	}
+}
+
+func TestGenerateResumeDP(t *testing.T) {
+	dir := t.TempDir()
+	full := filepath.Join(dir, "full.rbc")
+	crashed := filepath.Join(dir, "crashed.rbc")
+
+	// short maximum length, so that chains are discarded
+	if e := getTestDPRainbow(5, 40).Generate(full, 60, 10); e != nil {
+		t.Fatal(e)
+	}
+	ref, _ := os.ReadFile(full)
+	os.WriteFile(crashed, ref[:len(ref)/2], 0644)
+	if e := getTestDPRainbow(5, 40).Generate(crashed, 60, 10); e != nil {
+		t.Fatal(e)
+	}
+	res, _ := os.ReadFile(crashed)
+	if !bytes.Equal(ref, res) {
+		t.Fatal("resumed generation differs from uninterrupted generation")
+	}
+
+	r := getTestDPRainbow(5, 40)
+	if e := r.LoadChainFile(crashed); e != nil {
+		t.Fatal(e)
+	}
+	_, index, ok := startIndex(r.chains[len(r.chains)-1].start)
+	if !ok || index < 60 {
+		t.Fatalf("expected discarded chains to use up indexes, last index is %d", index)
+	}
+}
@@ -0,0 +1,176 @@
+package rainbow
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"math/rand"
+	"time"
+)
+
+// number of records per checksum block
+const blockRecords = 4096
+
+// size of the trailer for count records, in bytes.
+func trailerSize(count uint64) uint64 {
+	nb := (count + blockRecords - 1) / blockRecords
+	return 4 + 4*nb + sha256.Size
+}
+
+// checksummer computes the trailer of a table file, as records are
+// written or read.
+// Each block of blockRecords records gets its own CRC-32,
+// to locate corruption. The final digest is the SHA-256 of the header,
+// followed by the SHA-256 of the records, block size and block CRCs.
+// This allows computing the digest while streaming records,
+// even if the header is only known at the end.
+type checksummer struct {
+	// inner hash, of records, block size and crcs
+	inner hash.Hash
+	// crc of the current block
+	crc hash.Hash32
+	// number of records in the current block
+	inBlock int
+	// crcs of the completed blocks
+	crcs []uint32
+}
+
+func newChecksummer() *checksummer {
+	return &checksummer{
+		inner: sha256.New(),
+		crc:   crc32.NewIEEE(),
+	}
+}
+
+// add a record.
+func (cs *checksummer) add(rec []byte) {
+	cs.inner.Write(rec)
+	cs.crc.Write(rec)
+	cs.inBlock++
+	if cs.inBlock == blockRecords {
+		cs.endBlock()
+	}
+}
+
+// close the current block.
+func (cs *checksummer) endBlock() {
+	cs.crcs = append(cs.crcs, cs.crc.Sum32())
+	cs.crc.Reset()
+	cs.inBlock = 0
+}
+
+// finish closes the last block, and returns the block crcs and digest.
+// No more record can be added afterwards.
+func (cs *checksummer) finish(fh *fileHeader) (crcs []uint32, digest []byte) {
+	if cs.inBlock > 0 {
+		cs.endBlock()
+	}
+	binary.Write(cs.inner, mode, uint32(blockRecords))
+	for _, c := range cs.crcs {
+		binary.Write(cs.inner, mode, c)
+	}
+	outer := sha256.New()
+	outer.Write(fh.bytes())
+	outer.Write(cs.inner.Sum(nil))
+	return cs.crcs, outer.Sum(nil)
+}
+
+// trailer returns the binary trailer, for a file with header fh.
+func (cs *checksummer) trailer(fh *fileHeader) []byte {
+	crcs, digest := cs.finish(fh)
+	buf := new(bytes.Buffer)
+	binary.Write(buf, mode, uint32(blockRecords))
+	for _, c := range crcs {
+		binary.Write(buf, mode, c)
+	}
+	buf.Write(digest)
+	return buf.Bytes()
+}
+
+// verify reads the trailer from rd, and checks it matches
+// the records added so far.
+func (cs *checksummer) verify(fh *fileHeader, rd io.Reader) error {
+	crcs, digest := cs.finish(fh)
+
+	var bs uint32
+	if e := binary.Read(rd, mode, &bs); e != nil {
+		return readError(e, "reading trailer")
+	}
+	if bs != blockRecords {
+		return errorf(ErrCorrupted, "checksum block size %d", bs)
+	}
+	for i, c := range crcs {
+		var cc uint32
+		if e := binary.Read(rd, mode, &cc); e != nil {
+			return readError(e, "reading checksum of block %d", i)
+		}
+		if cc != c {
+			return errorf(ErrCorrupted, "block %d (chains %d to %d) fails its checksum",
+				i, i*blockRecords, (i+1)*blockRecords-1)
+		}
+	}
+	dd := make([]byte, sha256.Size)
+	if _, e := io.ReadFull(rd, dd); e != nil {
+		return readError(e, "reading digest")
+	}
+	if !bytes.Equal(dd, digest) {
+		return errorf(ErrCorrupted, "file digest does not match")
+	}
+	return nil
+}
+
+// Verify reads a complete table file from reader, checking its structure,
+// the ordering of its chains, the checksum of every block and the file
+// digest. It detects truncation and corruption, but does not check the
+// file was produced with any specific configuration, see SpotCheck.
+func Verify(reader io.Reader) error {
+	tr, err := newTableReader("table", reader)
+	if err != nil {
+		return err
+	}
+	for tr.rec != nil {
+		if err = tr.next(); err != nil {
+			return err
+		}
+	}
+	return tr.checkEOF()
+}
+
+// SpotCheck recomputes n chains of the table, chosen at random,
+// from their starts, and checks their ends match.
+// It confirms the table was generated with the same reduce and hash
+// configuration, which the signature only approximately guarantees.
+// All the chains are checked if n exceeds the table length.
+func (t *Table) SpotCheck(n int) error {
+	hf := getCryptoFunc(t.halgo)
+	rd := rand.New(rand.NewSource(time.Now().UnixNano()))
+	for k := 0; k < n && k < t.n; k++ {
+		i := k
+		if n < t.n {
+			i = rd.Intn(t.n)
+		}
+		end, length := t.chainEnd(hf, t.start(i))
+		if !bytes.Equal(end, t.end(i)) || length != t.length(i) {
+			return fmt.Errorf("chain %d does not match the current configuration", i)
+		}
+	}
+	return nil
+}
+
+// chainEnd computes the end and length of the chain starting with start.
+func (w *walker) chainEnd(hf HashFunction, start []byte) (end []byte, length int) {
+	buf := append([]byte{}, start...)
+	p := make([]byte, 0, w.hsize)
+	for i := 0; i < w.cl; i++ {
+		p = w.rf(w.step(i), buf, p)
+		buf = hf(p, buf)
+		if w.dp > 0 && distinguished(buf, w.dp) {
+			return buf, i + 1
+		}
+	}
+	return buf, w.cl
+}
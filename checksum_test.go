@@ -0,0 +1,85 @@
+package rainbow
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"strings"
+	"testing"
+)
+
+func TestVerify(t *testing.T) {
+	r := getTestRainbow(10)
+	for i := 0; i < 10_000; i++ {
+		r.AddChain(r.NewChain())
+	}
+	buf := new(bytes.Buffer)
+	if _, e := r.Freeze().WriteTo(buf); e != nil {
+		t.Fatal(e)
+	}
+	data := buf.Bytes()
+
+	if e := Verify(bytes.NewReader(data)); e != nil {
+		t.Fatal(e)
+	}
+
+	// truncation, anywhere
+	for _, cut := range []int{1, 10, 32, 100, 5_000, len(data) / 2, len(data) - 1} {
+		if e := Verify(bytes.NewReader(data[:len(data)-cut])); e == nil {
+			t.Fatalf("truncation of %d bytes was not detected", cut)
+		}
+	}
+
+	// corruption of a record is located
+	bad := append([]byte{}, data...)
+	bad[len(bad)-int(trailerSize(10_000))-116] ^= 1 // a start byte, not to break ordering
+	e := Verify(bytes.NewReader(bad))
+	if e == nil || !strings.Contains(e.Error(), "block 2") {
+		t.Fatal("corruption of the last block was not detected : ", e)
+	}
+
+	// corruption of the header or trailer
+	for _, pos := range []int{30, len(data) - 1, len(data) - sha256.Size - 2} {
+		bad := append([]byte{}, data...)
+		bad[pos] ^= 1
+		if e := Verify(bytes.NewReader(bad)); e == nil {
+			t.Fatalf("corruption at %d was not detected", pos)
+		}
+	}
+
+	// Load checks integrity too
+	rr := getTestRainbow(10)
+	if e := rr.Load(bytes.NewReader(bad)); e == nil {
+		t.Fatal("loading a corrupted table should fail")
+	}
+	if len(rr.chains) != 0 {
+		t.Fatalf("%d chains were added by a failed load", len(rr.chains))
+	}
+}
+
+func TestVerifyEmpty(t *testing.T) {
+	buf := new(bytes.Buffer)
+	getTestRainbow(10).Freeze().WriteTo(buf)
+	if e := Verify(buf); e != nil {
+		t.Fatal(e)
+	}
+}
+
+func TestSpotCheck(t *testing.T) {
+	r := getTestRainbow(20)
+	for i := 0; i < 200; i++ {
+		r.AddChain(r.NewChain())
+	}
+	tb := r.Freeze()
+	if e := tb.SpotCheck(50); e != nil {
+		t.Fatal(e)
+	}
+	if e := tb.SpotCheck(1_000); e != nil {
+		t.Fatal(e)
+	}
+
+	// a chain inconsistent with the configuration
+	tb.recs[100*tb.recordSize()+tb.hsize+3] ^= 1
+	if e := tb.SpotCheck(1_000); e == nil {
+		t.Fatal("inconsistent chain was not detected")
+	}
+}
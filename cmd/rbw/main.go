@@ -0,0 +1,174 @@
+// Command rbw provides maintenance operations on saved rainbow table files.
+//
+// Usage :
+//
+//	rbw merge [-remove-merged] -o output.rbw input1.rbw input2.rbw ...
+//	rbw split -n shards input.rbw
+//	rbw verify table.rbw ...
+//	rbw compress input.rbw output.rbwz
+//	rbw export [-rt] table.rbw
+//	rbw wordindex [-lines] [-nfc] [-lower] [-dedup] [-min n] [-max n] [-filter regexp] [-top n] words.txt output.rbwi
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/xavier268/go-rainbow"
+)
+
+// subcommands, by name
+var commands = map[string]func(args []string) error{
+	"merge":     merge,
+	"split":     split,
+	"verify":    verify,
+	"compress":  compress,
+	"export":    export,
+	"wordindex": wordindex,
+}
+
+func main() {
+	if len(os.Args) < 2 || commands[os.Args[1]] == nil {
+		usage()
+		os.Exit(2)
+	}
+	if err := commands[os.Args[1]](os.Args[2:]); err != nil {
+		fmt.Fprintln(os.Stderr, "rbw", os.Args[1], ":", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "rbw, go-rainbow", rainbow.VersionString())
+	fmt.Fprintln(os.Stderr, "usage :")
+	fmt.Fprintln(os.Stderr, "\trbw merge [-remove-merged] -o output.rbw input.rbw ...")
+	fmt.Fprintln(os.Stderr, "\trbw split -n shards input.rbw")
+	fmt.Fprintln(os.Stderr, "\trbw verify table.rbw ...")
+	fmt.Fprintln(os.Stderr, "\trbw compress input.rbw output.rbwz")
+	fmt.Fprintln(os.Stderr, "\trbw export [-rt] table.rbw")
+	fmt.Fprintln(os.Stderr, "\trbw wordindex [-lines] [-nfc] [-lower] [-dedup] [-min n] [-max n] [-filter regexp] [-top n] words.txt output.rbwi")
+}
+
+// merge sorted table files into a single one.
+func merge(args []string) error {
+	fs := flag.NewFlagSet("merge", flag.ExitOnError)
+	output := fs.String("o", "", "output table file")
+	removeMerged := fs.Bool("remove-merged", false, "keep a single chain per end point")
+	fs.Parse(args)
+	if *output == "" || fs.NArg() == 0 {
+		fs.Usage()
+		return fmt.Errorf("an output and at least one input are required")
+	}
+	return rainbow.MergeWithProgress(func(merged, dropped uint64) {
+		fmt.Println(merged, "chains merged,", dropped, "chains dropped")
+	}, *output, *removeMerged, fs.Args()...)
+}
+
+// split a table file into shards, named after the input file.
+func split(args []string) error {
+	fs := flag.NewFlagSet("split", flag.ExitOnError)
+	n := fs.Int("n", 2, "number of shards")
+	fs.Parse(args)
+	if fs.NArg() != 1 || *n <= 0 {
+		fs.Usage()
+		return fmt.Errorf("a single input and a positive number of shards are required")
+	}
+	input := fs.Arg(0)
+	base := strings.TrimSuffix(input, ".rbw")
+	var outputs []string
+	for i := 0; i < *n; i++ {
+		outputs = append(outputs, fmt.Sprintf("%s.shard%dof%d.rbw", base, i, *n))
+	}
+	return rainbow.Split(input, outputs...)
+}
+
+// verify the integrity of table files.
+func verify(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("at least one table file is required")
+	}
+	for _, fName := range args {
+		f, err := os.Open(fName)
+		if err != nil {
+			return err
+		}
+		err = rainbow.Verify(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s : %v", fName, err)
+		}
+		fmt.Println(fName, ": ok")
+	}
+	return nil
+}
+
+// compress a table file.
+func compress(args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("an input and an output are required")
+	}
+	return rainbow.Compress(args[0], args[1])
+}
+
+// export a table file to stdout, as text or in the .rt layout.
+func export(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	rt := fs.Bool("rt", false, "use the RainbowCrack .rt record layout")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("a single table file is required")
+	}
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if *rt {
+		return rainbow.ExportRT(os.Stdout, f)
+	}
+	return rainbow.ExportText(os.Stdout, f)
+}
+
+// wordindex builds a word index, from a word list, possibly compressed.
+func wordindex(args []string) error {
+	fs := flag.NewFlagSet("wordindex", flag.ExitOnError)
+	var opt rainbow.WordListOptions
+	fs.BoolVar(&opt.Lines, "lines", false, "read one word per line")
+	fs.BoolVar(&opt.NFC, "nfc", false, "normalize words to Unicode NFC")
+	fs.BoolVar(&opt.Lowercase, "lower", false, "convert words to lower case")
+	fs.BoolVar(&opt.Dedup, "dedup", false, "remove duplicated words")
+	fs.IntVar(&opt.MinLen, "min", 0, "minimum word length, in runes")
+	fs.IntVar(&opt.MaxLen, "max", 0, "maximum word length, in runes")
+	fs.IntVar(&opt.Top, "top", 0, "keep the first words only")
+	filter := fs.String("filter", "", "keep words matching this regular expression")
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return fmt.Errorf("a word list and an output are required")
+	}
+	if *filter != "" {
+		re, err := regexp.Compile(*filter)
+		if err != nil {
+			return err
+		}
+		opt.Filter = re
+	}
+	in, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	if err = rainbow.WriteWordIndex(out, in, opt); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,91 @@
+// Command rbwbench measures the time-memory tradeoff of rainbow tables,
+// across a grid of name space sizes, chain lengths and chain counts.
+// Results are written as CSV, one row per grid point, so runs on
+// different versions can be compared.
+//
+// Usage :
+//
+//	rbwbench [-alphabet abc...] [-len 2:3,2:4] [-cl 100,1000] [-chains 1000,10000] [-lookups 100] [-o bench.csv]
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/xavier268/go-rainbow"
+)
+
+func main() {
+	alphabet := flag.String("alphabet", "abcdefghijklmnopqrstuvwxyz", "password alphabet")
+	lens := flag.String("len", "2:3,3:4", "comma separated min:max password lengths")
+	cls := flag.String("cl", "100,1000", "comma separated chain lengths")
+	chains := flag.String("chains", "1000,10000", "comma separated chain counts")
+	lookups := flag.Int("lookups", 100, "number of lookups per grid point")
+	seed := flag.Int64("seed", 1, "random seed")
+	output := flag.String("o", "", "output CSV file, stdout if empty")
+	flag.Parse()
+
+	if err := run(*alphabet, *lens, *cls, *chains, *lookups, *seed, *output); err != nil {
+		fmt.Fprintln(os.Stderr, "rbwbench :", err)
+		os.Exit(1)
+	}
+}
+
+func run(alphabet, lens, cls, chains string, lookups int, seed int64, output string) error {
+	cl, err := ints(cls)
+	if err != nil {
+		return err
+	}
+	nc, err := ints(chains)
+	if err != nil {
+		return err
+	}
+	var cfgs []rainbow.TradeoffConfig
+	for _, l := range strings.Split(lens, ",") {
+		mm := strings.SplitN(l, ":", 2)
+		if len(mm) != 2 {
+			return fmt.Errorf("invalid length range %q", l)
+		}
+		min, e1 := strconv.Atoi(mm[0])
+		max, e2 := strconv.Atoi(mm[1])
+		if e1 != nil || e2 != nil {
+			return fmt.Errorf("invalid length range %q", l)
+		}
+		for _, c := range cl {
+			for _, n := range nc {
+				cfgs = append(cfgs, rainbow.TradeoffConfig{
+					Alphabet: alphabet, MinLen: min, MaxLen: max,
+					ChainLength: c, Chains: n, Lookups: lookups, Seed: seed,
+				})
+			}
+		}
+	}
+
+	var w io.Writer = os.Stdout
+	if output != "" {
+		f, err := os.Create(output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	return rainbow.WriteTradeoffCSV(w, cfgs...)
+}
+
+// ints parses a comma separated list of positive integers.
+func ints(s string) ([]int, error) {
+	var res []int
+	for _, f := range strings.Split(s, ",") {
+		v, err := strconv.Atoi(f)
+		if err != nil || v <= 0 {
+			return nil, fmt.Errorf("invalid value %q", f)
+		}
+		res = append(res, v)
+	}
+	return res, nil
+}
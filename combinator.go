@@ -0,0 +1,132 @@
+package rainbow
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// CombinatorOptions controls how CompileCombinator combines words.
+type CombinatorOptions struct {
+	// MinWords and MaxWords bound the number of words, each number
+	// being equally likely.
+	MinWords, MaxWords int
+	// Separators lists the separators, one of them being chosen
+	// for each password, and used between all its words.
+	// No separator is used when empty.
+	Separators []string
+	// Capitalize capitalizes the first letter of each word,
+	// or not, independently. Words that do not start with a cased
+	// letter are unchanged, and counted twice by name space estimations.
+	Capitalize bool
+}
+
+// CompileCombinator appends MinWords to MaxWords words, chosen from
+// lists, and joined with a separator, such as "blue-horse-42".
+// Word i is chosen from lists[i % len(lists)], so that a single list
+// provides all the words, while several lists are used in turn,
+// for instance adjectives, then nouns, then numbers.
+func (r *Rainbow) CompileCombinator(opt CombinatorOptions, lists ...[]string) *Rainbow {
+	arenas := make([]*wordArena, len(lists))
+	for i, l := range lists {
+		arenas[i] = newWordArena()
+		for _, w := range l {
+			arenas[i].add([]byte(w))
+		}
+	}
+	return r.compileCombinator(opt, arenas)
+}
+
+// CompileCombinatorFiles is like CompileCombinator, reading the lists
+// from word list files, as CompileWordListFile does.
+func (r *Rainbow) CompileCombinatorFiles(opt CombinatorOptions, wopt WordListOptions, fNames ...string) *Rainbow {
+	arenas := make([]*wordArena, len(fNames))
+	for i, fName := range fNames {
+		f, err := os.Open(fName)
+		if err != nil {
+			panic(err)
+		}
+		arenas[i], err = readWords(f, wopt)
+		f.Close()
+		if err != nil {
+			panic(err)
+		}
+	}
+	return r.compileCombinator(opt, arenas)
+}
+
+// compileCombinator compiles a combinator module, choosing words
+// from lists.
+func (r *Rainbow) compileCombinator(opt CombinatorOptions, lists []*wordArena) *Rainbow {
+	if len(lists) == 0 || opt.MinWords <= 0 || opt.MaxWords < opt.MinWords {
+		panic("invalid input parameters")
+	}
+	for _, l := range lists {
+		if l.len() == 0 {
+			panic("the word lists should not be empty")
+		}
+	}
+	seps := opt.Separators
+	if len(seps) == 0 {
+		seps = []string{""}
+	}
+	counts := uint64(opt.MaxWords - opt.MinWords + 1)
+	cases := 1.
+	if opt.Capitalize {
+		cases = 2
+	}
+
+	// signature, with a description of the lists
+	var desc []string
+	for _, l := range lists {
+		desc = append(desc, fmt.Sprintf("%d words, digest %x", l.len(), l.digest()))
+	}
+	mod := new(rmodule)
+	mod.signature = fmt.Sprintf("CompileCombinator with %d to %d words, separators %q, capitalize %v, lists : %s",
+		opt.MinWords, opt.MaxWords, seps, opt.Capitalize, strings.Join(desc, " ; "))
+
+	// one class per number of words, choices multiply
+	size := float64(counts) * float64(len(seps))
+	n := float64(len(seps))
+	for i := 0; i < opt.MaxWords; i++ {
+		choices := float64(lists[i%len(lists)].len()) * cases
+		size *= choices
+		n *= choices
+		if i+1 >= opt.MinWords {
+			mod.classes = append(mod.classes, pclass{p: 1 / float64(counts) / n, n: n})
+		}
+	}
+	mod.classes = compactClasses(mod.classes)
+	mod.bytes = entropyBytes(size)
+
+	mod.run = func(d *drawer, p []byte) []byte {
+		// decide on the number of words, and the separator
+		k := opt.MinWords + int(d.draw(counts))
+		sep := seps[d.draw(uint64(len(seps)))]
+
+		// append the words
+		for i := 0; i < k; i++ {
+			if i > 0 {
+				p = append(p, sep...)
+			}
+			l := lists[i%len(lists)]
+			w := l.word(int(d.draw(uint64(l.len()))))
+			if opt.Capitalize && d.draw(2) == 1 {
+				c, size := utf8.DecodeRune(w)
+				if u := unicode.ToUpper(c); u != c {
+					p = utf8.AppendRune(p, u)
+					w = w[size:]
+				}
+			}
+			p = append(p, w...)
+		}
+		return p
+	}
+
+	// append the module
+	r.rms = append(r.rms, mod)
+
+	return r
+}
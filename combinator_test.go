@@ -0,0 +1,36 @@
+package rainbow
+
+import (
+	"crypto"
+	"testing"
+)
+
+func TestCompileCombinator(t *testing.T) {
+	opt := CombinatorOptions{MinWords: 2, MaxWords: 3, Separators: []string{"-", "_"}}
+	r := New(crypto.MD5, 10).CompileCombinator(opt, []string{"blue", "red"}, []string{"horse", "cat", "dog"}, []string{"42"})
+	probs := make(map[string]float64)
+	for _, sep := range []string{"-", "_"} {
+		for _, a := range []string{"blue", "red"} {
+			for _, b := range []string{"horse", "cat", "dog"} {
+				probs[a+sep+b] = 1. / 2 / 2 / 2 / 3
+				probs[a+sep+b+sep+"42"] = 1. / 2 / 2 / 2 / 3
+			}
+		}
+	}
+	checkDistribution(t, "combinator", sample(r, 30_000), probs, 30_000)
+	if s := r.NamespaceSize(); s != 24 {
+		t.Fatalf("expected 24 passwords, got %v", s)
+	}
+
+	// words are capitalized independently, lists are used in turn,
+	// and digits are never capitalized
+	opt = CombinatorOptions{MinWords: 3, MaxWords: 3, Capitalize: true}
+	r = New(crypto.MD5, 10).CompileCombinator(opt, []string{"été"}, []string{"42"})
+	probs = map[string]float64{}
+	for _, a := range []string{"été", "Été"} {
+		for _, b := range []string{"été", "Été"} {
+			probs[a+"42"+b] = 1. / 4
+		}
+	}
+	checkDistribution(t, "combinator capitalize", sample(r, 10_000), probs, 10_000)
+}
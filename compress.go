@@ -0,0 +1,704 @@
+package rainbow
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/bits"
+	"os"
+	"sort"
+)
+
+// Compressed table file layout :
+//
+//	header     same as the table file header, with magic "RBWZ"
+//	blocks     the sorted records, by blocks of zBlockRecords records
+//	index      one entry per block, its offset from the first block,
+//	           uint64
+//	trailer    same as the table file trailer, computed on the
+//	           decoded records and on the table file header,
+//	           so compressing a table does not change its digest.
+//
+// Each block is made of :
+//
+//	first      hsize bytes, the first end of the block
+//	k          1 byte, Rice parameter
+//	zlen       uint32, length of the Rice coded section, in bytes
+//	ns         1 byte, number of seeds
+//	w          1 byte, number of bits per chain index
+//	slen       uint32, length of the starts section, in bytes
+//	nraw       uint16, number of starts stored as is
+//	rice       the Rice coded deltas of the first 8 bytes of the ends,
+//	           read as big endian uint64, relative to the previous end
+//	seeds      ns seeds, uint64
+//	starts     for each record, the number of its seed, on
+//	           bits.Len(ns) bits, and if it is below ns, the index
+//	           of the chain, on w bits
+//	raw        for each record, the remaining bytes of the end,
+//	           and chain length if any, followed by the start
+//	           if its seed number is ns
+//
+// Since ends are sorted, their leading bytes grow slowly, and their
+// deltas need about 64-log2(count)+2 bits, instead of 64.
+// Starts derived from a seed, see seededStart, only need the index of
+// their chain. The seeds used by at least two records of the block are
+// listed once, the other starts, e.g. imported, are stored as is.
+
+// magic bytes identifying a compressed table file
+var zFileMagic = [4]byte{'R', 'B', 'W', 'Z'}
+
+// number of records per compressed block
+const zBlockRecords = 256
+
+// deltas whose quotient exceeds zEscape are stored raw
+const zEscape = 32
+
+// bitWriter packs bits, most significant first.
+type bitWriter struct {
+	buf   []byte
+	nbits uint
+}
+
+// write the n lower bits of v.
+func (bw *bitWriter) write(v uint64, n uint) {
+	for i := n; i > 0; i-- {
+		if bw.nbits%8 == 0 {
+			bw.buf = append(bw.buf, 0)
+		}
+		if v>>(i-1)&1 == 1 {
+			bw.buf[len(bw.buf)-1] |= 0x80 >> (bw.nbits % 8)
+		}
+		bw.nbits++
+	}
+}
+
+// bitReader reads bits written by a bitWriter.
+type bitReader struct {
+	buf []byte
+	pos uint
+}
+
+// read n bits.
+func (br *bitReader) read(n uint) (uint64, error) {
+	var v uint64
+	for i := uint(0); i < n; i++ {
+		if br.pos/8 >= uint(len(br.buf)) {
+			return 0, errorf(ErrCorrupted, "bit section overflow")
+		}
+		v = v<<1 | uint64(br.buf[br.pos/8]>>(7-br.pos%8)&1)
+		br.pos++
+	}
+	return v, nil
+}
+
+// writeRice writes d with Rice parameter k.
+func (bw *bitWriter) writeRice(d uint64, k uint) {
+	q := d >> k
+	if q >= zEscape {
+		bw.write(1<<zEscape-1, zEscape)
+		bw.write(d, 64)
+		return
+	}
+	bw.write(1<<(q+1)-2, uint(q)+1) // q ones, then a zero
+	bw.write(d, k)
+}
+
+// readRice reads a value written with writeRice.
+func (br *bitReader) readRice(k uint) (uint64, error) {
+	var q uint64
+	for q < zEscape {
+		b, e := br.read(1)
+		if e != nil {
+			return 0, e
+		}
+		if b == 0 {
+			break
+		}
+		q++
+	}
+	if q == zEscape {
+		return br.read(64)
+	}
+	r, e := br.read(k)
+	return q<<k | r, e
+}
+
+// riceParameter selects the Rice parameter for the deltas.
+func riceParameter(deltas []uint64) uint {
+	var sum float64
+	for _, d := range deltas {
+		sum += float64(d)
+	}
+	mean := sum / float64(len(deltas)+1)
+	k := uint(0)
+	for k < 63 && float64(uint64(1)<<(k+1)) <= mean {
+		k++
+	}
+	return k
+}
+
+// blockStarts selects the seeds listed in a block, and returns the
+// seed number and chain index of each record. Records whose start is
+// stored as is have seed number len(seeds).
+func blockStarts(recs [][]byte, hsize int) (seeds []uint64, ids []int, indexes []uint64) {
+	ids = make([]int, len(recs))
+	indexes = make([]uint64, len(recs))
+	recSeeds := make([]uint64, len(recs))
+	counts := make(map[uint64]int)
+	for i, rec := range recs {
+		seed, index, ok := startIndex(rec[:hsize])
+		if !ok {
+			ids[i] = -1
+			continue
+		}
+		recSeeds[i], indexes[i] = seed, index
+		counts[seed]++
+	}
+	number := make(map[uint64]int)
+	for i, seed := range recSeeds {
+		if ids[i] < 0 || counts[seed] < 2 {
+			ids[i] = -1
+			continue
+		}
+		if _, ok := number[seed]; !ok {
+			if len(seeds) == zMaxSeeds {
+				ids[i] = -1
+				continue
+			}
+			number[seed] = len(seeds)
+			seeds = append(seeds, seed)
+		}
+		ids[i] = number[seed]
+	}
+	for i := range ids {
+		if ids[i] < 0 {
+			ids[i], indexes[i] = len(seeds), 0
+		}
+	}
+	return seeds, ids, indexes
+}
+
+// maximum number of seeds in a block
+const zMaxSeeds = 255
+
+// encodeBlock encodes the records of a block.
+func encodeBlock(recs [][]byte, hsize int) []byte {
+	deltas := make([]uint64, len(recs))
+	prev := binary.BigEndian.Uint64(recs[0][hsize:])
+	for i, rec := range recs {
+		hi := binary.BigEndian.Uint64(rec[hsize:])
+		deltas[i] = hi - prev
+		prev = hi
+	}
+	k := riceParameter(deltas)
+	bw := new(bitWriter)
+	for _, d := range deltas {
+		bw.writeRice(d, k)
+	}
+
+	seeds, ids, indexes := blockStarts(recs, hsize)
+	var max uint64
+	for _, x := range indexes {
+		if x > max {
+			max = x
+		}
+	}
+	w, sb := uint(bits.Len64(max)), uint(bits.Len(uint(len(seeds))))
+	sw := new(bitWriter)
+	nraw := 0
+	for i, id := range ids {
+		sw.write(uint64(id), sb)
+		if id < len(seeds) {
+			sw.write(indexes[i], w)
+		} else {
+			nraw++
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	buf.Write(recs[0][hsize : 2*hsize])
+	buf.WriteByte(byte(k))
+	binary.Write(buf, mode, uint32(len(bw.buf)))
+	buf.WriteByte(byte(len(seeds)))
+	buf.WriteByte(byte(w))
+	binary.Write(buf, mode, uint32(len(sw.buf)))
+	binary.Write(buf, mode, uint16(nraw))
+	buf.Write(bw.buf)
+	binary.Write(buf, mode, seeds)
+	buf.Write(sw.buf)
+	for i, rec := range recs {
+		buf.Write(rec[hsize+8:])
+		if ids[i] == len(seeds) {
+			buf.Write(rec[:hsize])
+		}
+	}
+	return buf.Bytes()
+}
+
+// maximum lengths of the Rice coded and starts sections of a block
+const (
+	zMaxRice   = zBlockRecords * (zEscape + 64) / 8
+	zMaxStarts = zBlockRecords * (8 + 64) / 8
+)
+
+// blockHead is the fixed size header of a block.
+type blockHead struct {
+	k                uint
+	zlen, slen, nraw int
+	ns               int
+	w                uint
+}
+
+// size of the fixed header of a block
+func blockHeadSize(hsize int) int {
+	return hsize + 13
+}
+
+// parseBlockHead parses and checks the fixed header of a block of n records.
+func parseBlockHead(head []byte, n, hsize int) (bh blockHead, err error) {
+	head = head[hsize:]
+	bh.k = uint(head[0])
+	bh.zlen = int(mode.Uint32(head[1:5]))
+	bh.ns = int(head[5])
+	bh.w = uint(head[6])
+	bh.slen = int(mode.Uint32(head[7:11]))
+	bh.nraw = int(mode.Uint16(head[11:13]))
+	if bh.k > 63 || bh.zlen > zMaxRice || bh.w > 64 || bh.slen > zMaxStarts ||
+		bh.nraw > n || bh.ns > 0 && hsize < 16 {
+		return bh, errorf(ErrCorrupted, "invalid block header")
+	}
+	return bh, nil
+}
+
+// size of the block, after its fixed header.
+func (bh blockHead) bodySize(n, hsize, recsize int) int {
+	return bh.zlen + 8*bh.ns + bh.slen + n*(recsize-hsize-8) + bh.nraw*hsize
+}
+
+// decodeBlock decodes n records of recsize bytes from the block.
+func decodeBlock(block []byte, n, hsize, recsize int) (recs [][]byte, err error) {
+	hs := blockHeadSize(hsize)
+	if len(block) < hs {
+		return nil, errorf(ErrTruncated, "reading block header")
+	}
+	first := block[:hsize]
+	bh, err := parseBlockHead(block[:hs], n, hsize)
+	if err != nil {
+		return nil, err
+	}
+	block = block[hs:]
+	if len(block) < bh.bodySize(n, hsize, recsize) {
+		return nil, errorf(ErrTruncated, "reading block records")
+	}
+	br := &bitReader{buf: block[:bh.zlen]}
+	block = block[bh.zlen:]
+	seeds := make([]uint64, bh.ns)
+	for i := range seeds {
+		seeds[i] = mode.Uint64(block[8*i:])
+	}
+	block = block[8*bh.ns:]
+	sr := &bitReader{buf: block[:bh.slen]}
+	raw := block[bh.slen:]
+	sb := uint(bits.Len(uint(bh.ns)))
+
+	hi := binary.BigEndian.Uint64(first)
+	nraw := 0
+	recs = make([][]byte, n)
+	for i := range recs {
+		d, e := br.readRice(bh.k)
+		if e != nil {
+			return nil, e
+		}
+		hi += d
+		rec := make([]byte, recsize)
+		binary.BigEndian.PutUint64(rec[hsize:], hi)
+		rs := recsize - hsize - 8
+		copy(rec[hsize+8:], raw[:rs])
+		raw = raw[rs:]
+
+		id, e := sr.read(sb)
+		if e != nil {
+			return nil, e
+		}
+		switch {
+		case id < uint64(bh.ns):
+			index, e := sr.read(bh.w)
+			if e != nil {
+				return nil, e
+			}
+			copy(rec, seededStart(seeds[id], index, hsize))
+		case id == uint64(bh.ns) && nraw < bh.nraw:
+			copy(rec, raw[:hsize])
+			raw = raw[hsize:]
+			nraw++
+		default:
+			return nil, errorf(ErrCorrupted, "invalid start")
+		}
+		recs[i] = rec
+	}
+	if nraw != bh.nraw {
+		return nil, errorf(ErrCorrupted, "inconsistent number of starts")
+	}
+	if !bytes.Equal(recs[0][hsize:2*hsize], first) {
+		return nil, errorf(ErrCorrupted, "inconsistent first end")
+	}
+	return recs, nil
+}
+
+// readBlock reads the n records of the next block from rd.
+func readBlock(rd io.Reader, n, hsize, recsize int) ([][]byte, error) {
+	head := make([]byte, blockHeadSize(hsize))
+	if _, e := io.ReadFull(rd, head); e != nil {
+		return nil, readError(e, "reading block header")
+	}
+	bh, e := parseBlockHead(head, n, hsize)
+	if e != nil {
+		return nil, e
+	}
+	block := make([]byte, len(head)+bh.bodySize(n, hsize, recsize))
+	copy(block, head)
+	if _, e := io.ReadFull(rd, block[len(head):]); e != nil {
+		return nil, readError(e, "reading block")
+	}
+	return decodeBlock(block, n, hsize, recsize)
+}
+
+// zStream decodes the records of a compressed table file, sequentially.
+type zStream struct {
+	rd             io.Reader
+	hsize, recsize int
+	// records decoded from the current block, not yet consumed
+	pending [][]byte
+	// number of records not yet decoded
+	left uint64
+	// number of blocks
+	nb uint64
+}
+
+// next decodes the next record.
+func (zs *zStream) next() ([]byte, error) {
+	if len(zs.pending) == 0 {
+		n := uint64(zBlockRecords)
+		if zs.left < n {
+			n = zs.left
+		}
+		recs, e := readBlock(zs.rd, int(n), zs.hsize, zs.recsize)
+		if e != nil {
+			return nil, e
+		}
+		zs.pending = recs
+		zs.left -= n
+	}
+	rec := zs.pending[0]
+	zs.pending = zs.pending[1:]
+	return rec, nil
+}
+
+// skipIndex skips the index, once all records are read.
+func (zs *zStream) skipIndex() error {
+	n, e := io.CopyN(io.Discard, zs.rd, int64(zs.nb*8))
+	if e != nil || uint64(n) != zs.nb*8 {
+		return readError(io.ErrUnexpectedEOF, "reading index")
+	}
+	return nil
+}
+
+// compressTo writes count records provided by next, in sorted order,
+// as a compressed table file with header fh.
+func compressTo(w io.Writer, fh *fileHeader, next func() ([]byte, error)) (n int64, err error) {
+	if fh.hsize < 8 {
+		return 0, errors.New("cannot compress tables with hashes shorter than 8 bytes")
+	}
+	buf := bufio.NewWriter(w)
+	hb := fh.bytes()
+	copy(hb, zFileMagic[:])
+	nn, err := buf.Write(hb)
+	n += int64(nn)
+	if err != nil {
+		return n, err
+	}
+
+	cs := newChecksummer()
+	index := new(bytes.Buffer)
+	var offset uint64
+	block := make([][]byte, 0, zBlockRecords)
+	flush := func() error {
+		if len(block) == 0 {
+			return nil
+		}
+		binary.Write(index, mode, offset)
+		enc := encodeBlock(block, fh.hsize)
+		nn, e := buf.Write(enc)
+		n += int64(nn)
+		offset += uint64(nn)
+		block = block[:0]
+		return e
+	}
+
+	for i := uint64(0); i < fh.count; i++ {
+		rec, e := next()
+		if e != nil {
+			return n, e
+		}
+		cs.add(rec)
+		block = append(block, rec)
+		if len(block) == zBlockRecords {
+			if err = flush(); err != nil {
+				return n, err
+			}
+		}
+	}
+	if err = flush(); err != nil {
+		return n, err
+	}
+
+	nn, err = buf.Write(index.Bytes())
+	n += int64(nn)
+	if err != nil {
+		return n, err
+	}
+	nn, err = buf.Write(cs.trailer(fh))
+	n += int64(nn)
+	if err != nil {
+		return n, err
+	}
+	return n, buf.Flush()
+}
+
+// WriteCompressed writes the table to w, using the compressed table
+// file format. The result can be read with Load, or opened for lookups
+// with OpenCompressedTable.
+func (t *Table) WriteCompressed(w io.Writer) (n int64, err error) {
+	i := 0
+	return compressTo(w, t.fileHeader(), func() ([]byte, error) {
+		rec := t.recs[i*t.recordSize() : (i+1)*t.recordSize()]
+		i++
+		return rec, nil
+	})
+}
+
+// Compress compresses the table file input into output,
+// streaming, without loading the table in memory.
+func Compress(input, output string) (err error) {
+	tr, err := openTableReader(input)
+	if err != nil {
+		return err
+	}
+	defer tr.close()
+	if tr.z != nil {
+		return fmt.Errorf("%s is already compressed", input)
+	}
+
+	f, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if e := f.Close(); err == nil {
+			err = e
+		}
+	}()
+
+	_, err = compressTo(f, tr.fh, func() ([]byte, error) {
+		rec := tr.rec
+		if rec == nil {
+			return nil, errorf(ErrTruncated, "%s", input)
+		}
+		return rec, tr.next()
+	})
+	if err != nil {
+		return err
+	}
+	return tr.checkEOF()
+}
+
+// CompressedTable is a read-only table, opened from a compressed
+// table file. Lookups only decode the few blocks that may contain
+// a candidate end point.
+// A CompressedTable is safe for concurrent use by multiple goroutines.
+type CompressedTable struct {
+	walker
+	fh *fileHeader
+	// memory mapped file content
+	mapped []byte
+	// blocks and index sections of the file
+	blocks, index []byte
+	// number of blocks
+	nb int
+}
+
+// number of compressed blocks for count records.
+func zBlocks(count uint64) uint64 {
+	return (count + zBlockRecords - 1) / zBlockRecords
+}
+
+// OpenCompressedTable opens a compressed table file, previously saved
+// with the same configuration as r. The file is memory mapped when the
+// platform allows it, and is never fully decompressed.
+// The returned table should be closed when no longer needed.
+func (r *Rainbow) OpenCompressedTable(fName string) (*CompressedTable, error) {
+	if r.rf == nil {
+		return nil, errors.New("cannot open table : the reduce function was not built yet")
+	}
+	f, err := os.Open(fName)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	tr, err := newTableReader(fName, f)
+	if err != nil {
+		return nil, err
+	}
+	if tr.z == nil {
+		return nil, errorf(ErrBadMagic, "%s is not compressed", fName)
+	}
+	fh := tr.fh
+	if err = r.checkFileHeader(fh); err != nil {
+		return nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	nb := zBlocks(fh.count)
+	isize := nb * 8
+	tsize := trailerSize(fh.count)
+	size := uint64(fi.Size())
+	if size < uint64(fh.size())+isize+tsize {
+		return nil, errorf(ErrTruncated, "%s", fName)
+	}
+	data, err := mmapFile(f, int(size))
+	if err != nil {
+		return nil, err
+	}
+
+	t := &CompressedTable{walker: r.walker(), fh: fh, mapped: data, nb: int(nb)}
+	t.blocks = data[fh.size() : size-tsize-isize]
+	t.index = data[size-tsize-isize : size-tsize]
+	return t, nil
+}
+
+// Close releases the resources associated with the table.
+// The table cannot be used afterwards.
+func (t *CompressedTable) Close() error {
+	if t.mapped == nil {
+		return nil
+	}
+	e := munmapFile(t.mapped)
+	t.mapped, t.blocks, t.index, t.nb = nil, nil, nil, 0
+	return e
+}
+
+// Len is the number of chains in the table.
+func (t *CompressedTable) Len() int {
+	return int(t.fh.count)
+}
+
+// Signature is the human readable signature of the configuration
+// used to generate the table.
+func (t *CompressedTable) Signature() string {
+	return t.signature
+}
+
+// ShardRange is the range of end point prefixes covered by the table,
+// lo included, hi excluded.
+func (t *CompressedTable) ShardRange() (lo, hi uint64) {
+	return t.fh.lo, t.fh.hi
+}
+
+// Stats provides statistics about the table.
+func (t *CompressedTable) Stats() TableStats {
+	return TableStats{
+		Chains:      int(t.fh.count),
+		ChainLength: t.cl,
+		MeanLength:  t.meanLength(),
+		HashSize:    t.hsize,
+		Bytes:       len(t.blocks) + len(t.index),
+	}
+}
+
+// meanLength is the average chain length.
+// In distinguished point mode, all the blocks are decoded.
+func (t *CompressedTable) meanLength() float64 {
+	if t.dp == 0 || t.nb == 0 {
+		return float64(t.cl)
+	}
+	var sum float64
+	for b := 0; b < t.nb; b++ {
+		recs, err := t.decode(b)
+		if err != nil {
+			return 0
+		}
+		for _, rec := range recs {
+			sum += float64(t.chainOf(rec).length)
+		}
+	}
+	return sum / float64(t.fh.count)
+}
+
+// offset of block b.
+func (t *CompressedTable) offset(b int) uint64 {
+	return mode.Uint64(t.index[b*8 : (b+1)*8])
+}
+
+// first end of block b, or nil if the block is out of range.
+func (t *CompressedTable) first(b int) []byte {
+	o := t.offset(b)
+	if o+uint64(t.hsize) > uint64(len(t.blocks)) {
+		return nil
+	}
+	return t.blocks[o : o+uint64(t.hsize)]
+}
+
+// decode block b.
+func (t *CompressedTable) decode(b int) ([][]byte, error) {
+	o := t.offset(b)
+	if o > uint64(len(t.blocks)) {
+		return nil, errorf(ErrCorrupted, "block %d offset", b)
+	}
+	n := zBlockRecords
+	if b == t.nb-1 {
+		n = int(t.fh.count) - b*zBlockRecords
+	}
+	return decodeBlock(t.blocks[o:], n, t.hsize, t.fh.recsize)
+}
+
+// FindStarts returns the starts of the chains ending with end.
+// Only the blocks that may contain end are decoded.
+func (t *CompressedTable) FindStarts(end []byte) [][]byte {
+	// first block starting at or after end
+	b := sort.Search(t.nb, func(i int) bool {
+		return bytes.Compare(t.first(i), end) >= 0
+	})
+	// matching chains may start in the previous block
+	if b > 0 {
+		b--
+	}
+	var starts [][]byte
+	for ; b < t.nb; b++ {
+		if bytes.Compare(t.first(b), end) > 0 {
+			break
+		}
+		recs, err := t.decode(b)
+		if err != nil {
+			return starts
+		}
+		for _, rec := range recs {
+			if bytes.Equal(rec[t.hsize:2*t.hsize], end) {
+				starts = append(starts, rec[:t.hsize])
+			}
+		}
+	}
+	return starts
+}
+
+// Lookup finds the password p that generated the hash h,
+// if it exists. Found indicates if found.
+func (t *CompressedTable) Lookup(h []byte) (p []byte, found bool) {
+	return t.lookup(h, t.FindStarts)
+}
@@ -0,0 +1,190 @@
+package rainbow
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRiceRoundTrip(t *testing.T) {
+	values := []uint64{0, 1, 2, 7, 100, 1 << 20, 1<<40 + 3, 1<<64 - 1}
+	for _, k := range []uint{0, 3, 20, 63} {
+		bw := new(bitWriter)
+		for _, v := range values {
+			bw.writeRice(v, k)
+		}
+		br := &bitReader{buf: bw.buf}
+		// a truncated section is detected
+		if _, e := (&bitReader{buf: bw.buf[:2]}).readRice(k); k == 63 && !errors.Is(e, ErrCorrupted) {
+			t.Fatal("reading past the end should fail")
+		}
+		for _, v := range values {
+			got, e := br.readRice(k)
+			if e != nil {
+				t.Fatal(e)
+			}
+			if got != v {
+				t.Fatalf("k=%d, expected %d, got %d", k, v, got)
+			}
+		}
+	}
+}
+
+func TestCompressedTable(t *testing.T) {
+	dir := t.TempDir()
+	r := getTestRainbow(30)
+	for i := 0; i < 3_000; i++ {
+		r.AddChain(r.NewChain())
+	}
+	frozen := r.Freeze()
+
+	// compress in memory, and compare sizes
+	plain, zipped := new(bytes.Buffer), new(bytes.Buffer)
+	if _, e := frozen.WriteTo(plain); e != nil {
+		t.Fatal(e)
+	}
+	if _, e := frozen.WriteCompressed(zipped); e != nil {
+		t.Fatal(e)
+	}
+	// starts only need their index, ends most of their bytes
+	if zipped.Len() >= plain.Len()*6/10 {
+		t.Fatalf("compressed size %d is not smaller than 60%% of %d", zipped.Len(), plain.Len())
+	}
+	if e := Verify(bytes.NewReader(zipped.Bytes())); e != nil {
+		t.Fatal(e)
+	}
+
+	// digests match, compression is lossless
+	tp, tz := plain.Bytes(), zipped.Bytes()
+	if !bytes.Equal(tp[len(tp)-32:], tz[len(tz)-32:]) {
+		t.Fatal("digests of plain and compressed files differ")
+	}
+
+	// Load reads compressed tables
+	rr := getTestRainbow(30)
+	if e := rr.Load(bytes.NewReader(tz)); e != nil {
+		t.Fatal(e)
+	}
+	if !bytes.Equal(rr.Freeze().recs, frozen.recs) {
+		t.Fatal("loaded records differ from the original")
+	}
+
+	// Compress from file to file
+	pname := filepath.Join(dir, "plain.rbw")
+	zname := filepath.Join(dir, "plain.rbwz")
+	os.WriteFile(pname, tp, 0644)
+	if e := Compress(pname, zname); e != nil {
+		t.Fatal(e)
+	}
+	data, _ := os.ReadFile(zname)
+	if !bytes.Equal(data, tz) {
+		t.Fatal("streaming compression differs from in memory compression")
+	}
+	if e := Compress(zname, filepath.Join(dir, "twice.rbwz")); e == nil {
+		t.Fatal("compressing twice should fail")
+	}
+
+	// lookups on the compressed table
+	if _, e := getTestRainbow(30).OpenTable(zname); !errors.Is(e, ErrBadMagic) {
+		t.Fatal("OpenTable should reject compressed tables : ", e)
+	}
+	if _, e := getTestRainbow(30).OpenCompressedTable(pname); !errors.Is(e, ErrBadMagic) {
+		t.Fatal("OpenCompressedTable should reject plain tables : ", e)
+	}
+	ct, e := getTestRainbow(30).OpenCompressedTable(zname)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer ct.Close()
+	if ct.Len() != frozen.Len() {
+		t.Fatalf("expected %d chains, got %d", frozen.Len(), ct.Len())
+	}
+	for i := 0; i < frozen.Len(); i++ {
+		if !bytes.Equal(bytes.Join(ct.FindStarts(frozen.end(i)), nil),
+			bytes.Join(frozen.FindStarts(frozen.end(i)), nil)) {
+			t.Fatalf("starts differ for chain %d", i)
+		}
+	}
+	for _, i := range []int{0, 17, 512, 2_999} {
+		psswd, h := r.getPHSample(r.chains[i], 1+i%30)
+		p, found := ct.Lookup(h)
+		if !found || !bytes.Equal(r.hf(p, []byte{}), r.hf(psswd, []byte{})) {
+			t.Fatalf("lookup failed on compressed table for chain %d", i)
+		}
+	}
+}
+
+func TestCompressedStarts(t *testing.T) {
+	// chains from two seeds, as when merging tables,
+	// and chains from random starts, as when importing them
+	r := getTestRainbow(10)
+	other := getTestRainbow(10)
+	other.rand = rand.New(rand.NewSource(7))
+	for i := 0; i < 1_000; i++ {
+		r.AddChain(r.NewChain(), other.NewChain())
+		if i%10 == 0 {
+			start := make([]byte, r.hsize)
+			r.rand.Read(start)
+			r.AddChain(r.chainFrom(start))
+		}
+	}
+	frozen := r.Freeze()
+	buf := new(bytes.Buffer)
+	if _, e := frozen.WriteCompressed(buf); e != nil {
+		t.Fatal(e)
+	}
+	rr := getTestRainbow(10)
+	if e := rr.Load(bytes.NewReader(buf.Bytes())); e != nil {
+		t.Fatal(e)
+	}
+	if !bytes.Equal(rr.Freeze().recs, frozen.recs) {
+		t.Fatal("loaded records differ from the original")
+	}
+
+	fname := filepath.Join(t.TempDir(), "starts.rbwz")
+	os.WriteFile(fname, buf.Bytes(), 0644)
+	ct, e := getTestRainbow(10).OpenCompressedTable(fname)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer ct.Close()
+	for i := 0; i < frozen.Len(); i += 7 {
+		if !bytes.Equal(bytes.Join(ct.FindStarts(frozen.end(i)), nil),
+			bytes.Join(frozen.FindStarts(frozen.end(i)), nil)) {
+			t.Fatalf("starts differ for chain %d", i)
+		}
+	}
+
+	// all starts stored as is
+	seeds, ids, _ := blockStarts([][]byte{frozen.recs[:2*r.hsize]}, r.hsize)
+	if len(seeds) != 0 || ids[0] != 0 {
+		t.Fatal("a single start should be stored as is")
+	}
+}
+
+func TestCompressedCorruption(t *testing.T) {
+	r := getTestRainbow(10)
+	for i := 0; i < 1_000; i++ {
+		r.AddChain(r.NewChain())
+	}
+	buf := new(bytes.Buffer)
+	if _, e := r.Freeze().WriteCompressed(buf); e != nil {
+		t.Fatal(e)
+	}
+	data := buf.Bytes()
+	for _, cut := range []int{1, 40, 500, len(data) / 2} {
+		if e := Verify(bytes.NewReader(data[:len(data)-cut])); e == nil {
+			t.Fatalf("truncation of %d bytes was not detected", cut)
+		}
+	}
+	for _, pos := range []int{100, 200, len(data) / 2, len(data) - 300} {
+		bad := append([]byte{}, data...)
+		bad[pos] ^= 0x10
+		if e := Verify(bytes.NewReader(bad)); e == nil {
+			t.Fatalf("corruption at %d was not detected", pos)
+		}
+	}
+}
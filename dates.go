@@ -0,0 +1,191 @@
+package rainbow
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dateTokens are the date format tokens, longest first.
+var dateTokens = []string{"YYYY", "YY", "MM", "M", "DD", "D"}
+
+// dateFormatter compiles a date format, such as "DD/MM/YY",
+// into a function appending a formatted date to b.
+// Tokens are YYYY and YY for the year, MM and M for the month,
+// DD and D for the day, M and D being unpadded. Other characters,
+// except Y, are copied.
+func dateFormatter(format string) func(b []byte, t time.Time) []byte {
+	var parts []func(b []byte, t time.Time) []byte
+	for rest := format; rest != ""; {
+		tok := ""
+		for _, k := range dateTokens {
+			if strings.HasPrefix(rest, k) {
+				tok = k
+				break
+			}
+		}
+		switch tok {
+		case "YYYY":
+			parts = append(parts, func(b []byte, t time.Time) []byte { return appendPadded(b, int64(t.Year()), 4) })
+		case "YY":
+			parts = append(parts, func(b []byte, t time.Time) []byte { return appendPadded(b, int64(t.Year()%100), 2) })
+		case "MM":
+			parts = append(parts, func(b []byte, t time.Time) []byte { return appendPadded(b, int64(t.Month()), 2) })
+		case "M":
+			parts = append(parts, func(b []byte, t time.Time) []byte { return appendPadded(b, int64(t.Month()), 1) })
+		case "DD":
+			parts = append(parts, func(b []byte, t time.Time) []byte { return appendPadded(b, int64(t.Day()), 2) })
+		case "D":
+			parts = append(parts, func(b []byte, t time.Time) []byte { return appendPadded(b, int64(t.Day()), 1) })
+		default:
+			if rest[0] == 'Y' {
+				panic(fmt.Sprintf("invalid date format %q", format))
+			}
+			lit := rest[:1]
+			parts = append(parts, func(b []byte, t time.Time) []byte { return append(b, lit...) })
+			tok = lit
+		}
+		rest = rest[len(tok):]
+	}
+	return func(b []byte, t time.Time) []byte {
+		for _, part := range parts {
+			b = part(b, t)
+		}
+		return b
+	}
+}
+
+// appendPadded appends v, in decimal, zero padded to width digits.
+// Negative values are prefixed with a minus sign.
+func appendPadded(b []byte, v int64, width int) []byte {
+	u := uint64(v)
+	if v < 0 {
+		b = append(b, '-')
+		u = -u
+	}
+	digits := strconv.FormatUint(u, 10)
+	for i := len(digits); i < width; i++ {
+		b = append(b, '0')
+	}
+	return append(b, digits...)
+}
+
+// CompileDate appends a date between from and to, inclusive, formatted
+// with one of the formats, such as "DDMMYYYY", "YYYY", "MMDD" or
+// "DD/MM/YY". Formats use the YYYY, YY, MM, M, DD and D tokens, M and
+// D being unpadded, other characters being copied. Only the calendar
+// dates of from and to matter.
+// A format is chosen first, then one of its distinct strings : with
+// "YYYY", each year is as likely, whatever the number of days in the
+// range. Name space estimations count each string once, even when
+// formats produce the same strings.
+func (r *Rainbow) CompileDate(from, to time.Time, formats ...string) *Rainbow {
+	first := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.UTC)
+	last := time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, time.UTC)
+	if len(formats) == 0 || last.Before(first) {
+		panic("invalid input parameters")
+	}
+
+	// distinct strings of each format
+	values := make([]*wordArena, len(formats))
+	for i, format := range formats {
+		if format == "" {
+			panic("empty date format")
+		}
+		f := dateFormatter(format)
+		values[i] = newWordArena()
+		seen := make(map[string]bool)
+		var b []byte
+		for t := first; !t.After(last); t = t.AddDate(0, 0, 1) {
+			if b = f(b[:0], t); !seen[string(b)] {
+				seen[string(b)] = true
+				values[i].add(b)
+			}
+		}
+	}
+
+	// probability of each string, across formats
+	probs := make(map[string]float64)
+	var largest int
+	for _, v := range values {
+		for i := 0; i < v.len(); i++ {
+			probs[string(v.word(i))] += 1 / float64(len(formats)) / float64(v.len())
+		}
+		if v.len() > largest {
+			largest = v.len()
+		}
+	}
+	counts := make(map[float64]float64)
+	for _, p := range probs {
+		counts[p]++
+	}
+
+	mod := new(rmodule)
+	mod.signature = fmt.Sprintf("CompileDate from %s to %s, formats %q", first.Format("2006-01-02"), last.Format("2006-01-02"), formats)
+	for p, n := range counts {
+		mod.classes = append(mod.classes, pclass{p: p, n: n})
+	}
+	mod.classes = compactClasses(mod.classes)
+	mod.bytes = entropyBytes(float64(len(formats)) * float64(largest))
+	mod.values = func(yield func(v []byte, q float64)) {
+		for s, q := range probs {
+			yield([]byte(s), q)
+		}
+	}
+	mod.run = func(d *drawer, p []byte) []byte {
+		// decide on the format, then on the date
+		v := values[d.draw(uint64(len(values)))]
+		return append(p, v.word(int(d.draw(uint64(v.len()))))...)
+	}
+
+	// append the module
+	r.rms = append(r.rms, mod)
+
+	return r
+}
+
+// CompileNumberRange appends an integer between lo and hi, inclusive,
+// in decimal, zero padded to width digits, such as "007" for 7 with
+// a width of 3. Use a width of 0 for no padding. Each integer is
+// as likely.
+func (r *Rainbow) CompileNumberRange(lo, hi int64, width int) *Rainbow {
+	if hi < lo || width < 0 {
+		panic("invalid input parameters")
+	}
+	// size of the range, 0 standing for 2^64
+	size := uint64(hi-lo) + 1
+	n := float64(size)
+	if size == 0 {
+		n = math.Ldexp(1, 64)
+	}
+
+	mod := new(rmodule)
+	mod.signature = fmt.Sprintf("CompileNumberRange from %d to %d, width %d", lo, hi, width)
+	mod.classes = []pclass{{p: 1 / n, n: n}}
+	mod.bytes = entropyBytes(n)
+	if size != 0 {
+		mod.values = func(yield func(v []byte, q float64)) {
+			var b []byte
+			for i := uint64(0); i < size; i++ {
+				b = appendPadded(b[:0], lo+int64(i), width)
+				yield(b, 1/n)
+			}
+		}
+	}
+	mod.run = func(d *drawer, p []byte) []byte {
+		var v uint64
+		if size == 0 {
+			v = d.draw64()
+		} else {
+			v = d.draw(size)
+		}
+		return appendPadded(p, lo+int64(v), width)
+	}
+
+	// append the module
+	r.rms = append(r.rms, mod)
+
+	return r
+}
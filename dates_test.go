@@ -0,0 +1,80 @@
+package rainbow
+
+import (
+	"crypto"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestDateFormatter(t *testing.T) {
+	d := time.Date(2024, 3, 5, 23, 59, 0, 0, time.UTC)
+	for format, want := range map[string]string{
+		"DDMMYYYY": "05032024",
+		"YYYY":     "2024",
+		"MMDD":     "0305",
+		"DD/MM/YY": "05/03/24",
+		"D-M-YY":   "5-3-24",
+		"YYYYMMDD": "20240305",
+		"bday DD":  "bday 05",
+	} {
+		if got := string(dateFormatter(format)(nil, d)); got != want {
+			t.Fatalf("format %q : expected %q, got %q", format, want, got)
+		}
+	}
+	defer func() {
+		if recover() == nil {
+			t.Fatal("a lone Y should be rejected")
+		}
+	}()
+	dateFormatter("YYY")
+}
+
+func TestCompileDate(t *testing.T) {
+	from := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2001, 12, 31, 12, 0, 0, 0, time.Local)
+	r := New(crypto.MD5, 10).CompileDate(from, to, "YYYY", "MMDD")
+	if s := r.NamespaceSize(); s != 2+366 {
+		t.Fatalf("expected %d dates, got %v", 2+366, s)
+	}
+
+	// each format is as likely, then each of its strings
+	probs := map[string]float64{"2000": 1. / 4, "2001": 1. / 4}
+	for d := from; d.Year() == 2000; d = d.AddDate(0, 0, 1) {
+		probs[fmt.Sprintf("%02d%02d", d.Month(), d.Day())] = 1. / 2 / 366
+	}
+	checkDistribution(t, "dates", sample(r, 200_000), probs, 200_000)
+
+	// strings shared by formats are counted once
+	r = New(crypto.MD5, 10).CompileDate(from, from.AddDate(0, 0, 30), "MMDD", "DDMM")
+	if s := r.NamespaceSize(); s != 61 {
+		t.Fatalf("expected 61 dates, got %v", s)
+	}
+	if e := r.EffectiveNamespaceSize(); math.Abs(e-62.*62/(60+4)) > 1e-9 {
+		t.Fatalf("unexpected effective size %v", e)
+	}
+}
+
+func TestCompileNumberRange(t *testing.T) {
+	r := New(crypto.MD5, 10).CompileNumberRange(0, 99, 2)
+	probs := make(map[string]float64)
+	for i := 0; i < 100; i++ {
+		probs[fmt.Sprintf("%02d", i)] = 1. / 100
+	}
+	checkDistribution(t, "numbers", sample(r, 50_000), probs, 50_000)
+
+	r = New(crypto.MD5, 10).CompileNumberRange(-2, 2, 3)
+	checkDistribution(t, "signed numbers", sample(r, 5_000),
+		map[string]float64{"-002": .2, "-001": .2, "000": .2, "001": .2, "002": .2}, 5_000)
+
+	r = New(crypto.MD5, 10).CompileNumberRange(math.MinInt64, math.MaxInt64, 0)
+	if s := r.NamespaceSize(); s != math.Ldexp(1, 64) {
+		t.Fatalf("unexpected size %v", s)
+	}
+	for s := range sample(r, 100) {
+		if len(s) < 10 {
+			t.Fatalf("unexpected number %q", s)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package rainbow
+
+import (
+	"bytes"
+	"crypto"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func getTestDPRainbow(bits, maxLength int) *Rainbow {
+	r := NewDistinguished(crypto.MD5, bits, maxLength).CompileAlphabet("abcdefghijklmnopqrstuvwxyz", 2, 3).Build()
+	r.rand = rand.New(rand.NewSource(42))
+	return r
+}
+
+func TestDistinguished(t *testing.T) {
+	for _, c := range []struct {
+		h    []byte
+		bits int
+		ok   bool
+	}{
+		{[]byte{0x00, 0xFF}, 8, true},
+		{[]byte{0x00, 0xFF}, 9, false},
+		{[]byte{0x00, 0x7F}, 9, true},
+		{[]byte{0x0F, 0x00}, 4, true},
+		{[]byte{0x1F, 0x00}, 4, false},
+		{[]byte{0x00, 0x00}, 16, true},
+	} {
+		if distinguished(c.h, c.bits) != c.ok {
+			t.Fatalf("distinguished(% X, %d) should be %v", c.h, c.bits, c.ok)
+		}
+	}
+}
+
+func TestDPChains(t *testing.T) {
+	r := getTestDPRainbow(4, 200)
+	for i := 0; i < 300; i++ {
+		c := r.NewChain()
+		if !distinguished(c.end, 4) || c.length <= 0 || c.length > 200 {
+			t.Fatalf("invalid chain, end % X, length %d", c.end, c.length)
+		}
+		r.AddChain(c)
+	}
+
+	// every point of every chain can be found
+	for _, c := range r.chains[:50] {
+		for level := 1; level <= c.length; level++ {
+			psswd, h := r.getDPSample(c, level)
+			p, found := r.Lookup(h)
+			if !found || !bytes.Equal(r.hf(p, []byte{}), r.hf(psswd, []byte{})) {
+				t.Fatalf("lookup failed for level %d of %d", level, c.length)
+			}
+		}
+	}
+
+	// lengths survive a save and load, and SpotCheck agrees
+	buf := new(bytes.Buffer)
+	if e := r.Save(buf); e != nil {
+		t.Fatal(e)
+	}
+	rr := getTestDPRainbow(4, 200)
+	if e := rr.Load(bytes.NewReader(buf.Bytes())); e != nil {
+		t.Fatal(e)
+	}
+	frozen := rr.Freeze()
+	if e := frozen.SpotCheck(frozen.Len()); e != nil {
+		t.Fatal(e)
+	}
+	if st := frozen.Stats(); st.MeanLength < 5 || st.MeanLength > 40 {
+		t.Fatalf("unexpected mean length %f", st.MeanLength)
+	}
+
+	// a classic table cannot read it
+	if e := getTestRainbow(200).Load(bytes.NewReader(buf.Bytes())); e == nil {
+		t.Fatal("loading distinguished point chains in a classic table should fail")
+	}
+
+	// compressed tables keep the lengths
+	fname := filepath.Join(t.TempDir(), "dp.rbwz")
+	saveCompressedTestTable(t, frozen, fname)
+	ct, e := getTestDPRainbow(4, 200).OpenCompressedTable(fname)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer ct.Close()
+	if ct.Stats().MeanLength != frozen.Stats().MeanLength {
+		t.Fatal("mean lengths differ after compression")
+	}
+	c := r.chains[7]
+	psswd, h := r.getDPSample(c, c.length)
+	if p, found := ct.Lookup(h); !found || !bytes.Equal(r.hf(p, []byte{}), r.hf(psswd, []byte{})) {
+		t.Fatal("lookup failed on compressed table")
+	}
+
+	// and so do text exports
+	txt := new(bytes.Buffer)
+	if e = ExportText(txt, bytes.NewReader(buf.Bytes())); e != nil {
+		t.Fatal(e)
+	}
+	rt := getTestDPRainbow(4, 200)
+	if e = rt.ImportText(txt); e != nil {
+		t.Fatal(e)
+	}
+	if !bytes.Equal(rt.Freeze().recs, frozen.recs) {
+		t.Fatal("text export lost chain lengths")
+	}
+}
+
+func TestDPLoopAndCutoff(t *testing.T) {
+	// a tiny name space loops quickly, and never reaches 40 zero bits
+	r := NewDistinguished(crypto.MD5, 40, 1_000_000).CompileAlphabet("ab", 1, 1).Build()
+	c, loop := r.dpChainFrom(make([]byte, 16))
+	if c != nil || !loop {
+		t.Fatal("loop was not detected")
+	}
+
+	// cutoff, without loop
+	r = getTestDPRainbow(40, 20)
+	c, loop = r.dpChainFrom(make([]byte, 16))
+	if c != nil || loop {
+		t.Fatal("chain should have been cut off")
+	}
+}
+
+// TestDPSuccessRate compares distinguished point chains with classic
+// rainbow chains, for the same number of chain points.
+func TestDPSuccessRate(t *testing.T) {
+	const points = 6_000
+
+	classic := getTestRainbow(30)
+	for i := 0; i < points/30; i++ {
+		classic.AddChain(classic.NewChain())
+	}
+	dp := getTestDPRainbow(5, 300)
+	for n := 0; n < points; {
+		c := dp.NewChain()
+		dp.AddChain(c)
+		n += c.length
+	}
+	ct, dt := classic.Freeze(), dp.Freeze()
+
+	rd := rand.New(rand.NewSource(7))
+	alpha := "abcdefghijklmnopqrstuvwxyz"
+	hf := getCryptoFunc(crypto.MD5)
+	var cFound, dFound int
+	const tries = 300
+	for i := 0; i < tries; i++ {
+		p := make([]byte, 2+rd.Intn(2))
+		for j := range p {
+			p[j] = alpha[rd.Intn(len(alpha))]
+		}
+		h := hf(p, nil)
+		if _, found := ct.Lookup(h); found {
+			cFound++
+		}
+		if _, found := dt.Lookup(h); found {
+			dFound++
+		}
+	}
+	t.Logf("success rate with %d points : classic %d chains %.1f %%, distinguished points %d chains %.1f %%",
+		points, ct.Len(), 100*float64(cFound)/tries, dt.Len(), 100*float64(dFound)/tries)
+	if dFound == 0 || cFound == 0 {
+		t.Fatal("success rates are unexpectedly low")
+	}
+	if dFound < cFound/3 {
+		t.Fatal("distinguished point success rate is far below the classic rate")
+	}
+}
+
+// Get a sample hash with coresponding password, at level steps
+// from the start of a distinguished point chain.
+func (r *Rainbow) getDPSample(c *Chain, level int) (p, h []byte) {
+	h = append([]byte{}, c.start...)
+	for i := 0; i < level; i++ {
+		p = r.rf(0, h, p)
+		h = r.hf(p, h)
+	}
+	return p, h
+}
+
+func saveCompressedTestTable(t *testing.T, tb *Table, fName string) {
+	buf := new(bytes.Buffer)
+	if _, e := tb.WriteCompressed(buf); e != nil {
+		t.Fatal(e)
+	}
+	if e := os.WriteFile(fName, buf.Bytes(), 0644); e != nil {
+		t.Fatal(e)
+	}
+}
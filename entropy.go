@@ -0,0 +1,96 @@
+package rainbow
+
+import (
+	"math"
+	"math/bits"
+)
+
+// Modules select values among n choices from their entropy bytes.
+// Taking a byte modulo n favours the first values when 256 is not
+// a multiple of n. Instead, the entropy bytes are read as the binary
+// digits of a fraction u in [0,1), and values are drawn as its digits
+// in a mixed radix : the first value is floor(u*n1), then u is replaced
+// by the fractional part of u*n1, and so on. Only multiplications are
+// needed. Provided u has entropySlack more bytes than needed to cover
+// the product of all the n, the bias of any selection stays below 2^-64.
+// All the modules of a reduce step draw from the same u, so the slack
+// is only paid once per step. When the modules need more bytes than the
+// hash provides, u gets bytes derived by hashing it again with a counter,
+// see stretch, rather than copies of the hash.
+
+// number of extra entropy bytes, beyond the bytes needed to cover
+// the choices of all the modules
+const entropySlack = 8
+
+// entropyBytes is the number of entropy bytes a module needs,
+// to make a series of choices whose product is size,
+// not counting entropySlack.
+func entropyBytes(size float64) int {
+	if size <= 1 {
+		return 0
+	}
+	return int(math.Ceil(math.Log2(size) / 8))
+}
+
+// number of words kept on the stack by a drawer
+const drawerWords = 16
+
+// drawer draws nearly uniform values from entropy bytes.
+// Short entropy is kept on the stack.
+type drawer struct {
+	// u, as 64 bits words, most significant first,
+	// either the first n words of stack, or heap
+	stack [drawerWords]uint64
+	n     int
+	heap  []uint64
+}
+
+// init loads the entropy bytes.
+func (d *drawer) init(ent []byte) {
+	d.n = (len(ent) + 7) / 8
+	words := d.stack[:]
+	d.heap = nil
+	if d.n > drawerWords {
+		d.heap = make([]uint64, d.n)
+		words = d.heap
+	}
+	for i := 0; i < d.n; i++ {
+		words[i] = 0
+	}
+	for i, b := range ent {
+		words[i/8] |= uint64(b) << (56 - 8*(i%8))
+	}
+}
+
+// draw64 returns floor(u*2^64),
+// and replaces u with the fractional part of u*2^64.
+func (d *drawer) draw64() uint64 {
+	words := d.heap
+	if words == nil {
+		words = d.stack[:d.n]
+	}
+	if len(words) == 0 {
+		return 0
+	}
+	v := words[0]
+	copy(words, words[1:])
+	words[len(words)-1] = 0
+	return v
+}
+
+// draw returns floor(u*n), a value in [0, n),
+// and replaces u with the fractional part of u*n.
+func (d *drawer) draw(n uint64) uint64 {
+	words := d.heap
+	if words == nil {
+		words = d.stack[:d.n]
+	}
+	var carry uint64
+	for i := len(words) - 1; i >= 0; i-- {
+		hi, lo := bits.Mul64(words[i], n)
+		var c uint64
+		words[i], c = bits.Add64(lo, carry, 0)
+		carry = hi + c
+	}
+	return carry
+}
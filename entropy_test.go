@@ -0,0 +1,221 @@
+package rainbow
+
+import (
+	"crypto"
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"testing"
+)
+
+func TestDrawer(t *testing.T) {
+	// u = 258/65536, u*2 = 516/65536, u*10 = 5160/65536,
+	// u*100 = 7 + 57248/65536, u*7 = 6 + 7520/65536
+	var d drawer
+	d.init([]byte{0x01, 0x02})
+	for _, c := range []struct{ n, v uint64 }{{2, 0}, {10, 0}, {100, 7}, {7, 6}} {
+		if v := d.draw(c.n); v != c.v {
+			t.Fatalf("drawing among %d, expected %d, got %d", c.n, c.v, v)
+		}
+	}
+
+	// more than drawerWords words
+	ent := make([]byte, 8*drawerWords+3)
+	ent[0], ent[len(ent)-1] = 5, 0x80
+	d.init(ent)
+	if v := d.draw(256); v != 5 {
+		t.Fatalf("expected 5, got %d", v)
+	}
+	for i := 1; i < len(ent)-1; i++ {
+		if v := d.draw(256); v != 0 {
+			t.Fatalf("expected 0, got %d", v)
+		}
+	}
+	if v := d.draw(2); v != 1 {
+		t.Fatalf("expected 1, got %d", v)
+	}
+}
+
+// chiSquare computes the chi-square statistic of the observed counts,
+// and its critical value at the 0.1% significance level.
+func chiSquare(counts map[string]float64, probs map[string]float64, n int) (chi2, crit float64) {
+	for k, p := range probs {
+		e := p * float64(n)
+		chi2 += (counts[k] - e) * (counts[k] - e) / e
+	}
+	// Wilson-Hilferty approximation of the chi-square quantile
+	df := float64(len(probs) - 1)
+	crit = df * math.Pow(1-2/(9*df)+3.09*math.Sqrt(2/(9*df)), 3)
+	return chi2, crit
+}
+
+// checkDistribution checks that the observed counts are compatible
+// with the expected probabilities.
+func checkDistribution(t *testing.T, what string, counts map[string]float64, probs map[string]float64, n int) {
+	t.Helper()
+	for k := range counts {
+		if _, ok := probs[k]; !ok {
+			t.Fatalf("%s : unexpected value %q", what, k)
+		}
+	}
+	if chi2, crit := chiSquare(counts, probs, n); chi2 > crit {
+		t.Fatalf("%s : chi-square %.1f exceeds %.1f", what, chi2, crit)
+	}
+}
+
+// runModule runs mod on the entropy ent, as the reduce function does.
+func runModule(mod *rmodule, ent, p []byte) []byte {
+	var d drawer
+	d.init(ent)
+	return mod.run(&d, p)
+}
+
+// sample runs the single module of r n times, on random entropy.
+func sample(r *Rainbow, n int) map[string]float64 {
+	mod := r.rms[0]
+	rd := rand.New(rand.NewSource(42))
+	ent := make([]byte, mod.bytes+entropySlack)
+	counts := make(map[string]float64)
+	for i := 0; i < n; i++ {
+		rd.Read(ent)
+		counts[string(runModule(mod, ent, nil))]++
+	}
+	return counts
+}
+
+func TestUniformAlphabet(t *testing.T) {
+	const n = 200_000
+	alpha := "abcdefghijklmnopqrstuvwxyz"
+
+	// letters, 256 % 26 != 0
+	probs := make(map[string]float64)
+	for _, c := range alpha {
+		probs[string(c)] = 1. / 26
+	}
+	checkDistribution(t, "letters", sample(New(crypto.MD5, 10).CompileAlphabet(alpha, 1, 1), n), probs, n)
+
+	// lengths, 256 % 7 != 0
+	counts := make(map[string]float64)
+	for p, c := range sample(New(crypto.MD5, 10).CompileAlphabet("x", 0, 6), n) {
+		counts[string(rune('0'+len(p)))] += c
+	}
+	probs = make(map[string]float64)
+	for l := 0; l <= 6; l++ {
+		probs[string(rune('0'+l))] = 1. / 7
+	}
+	checkDistribution(t, "lengths", counts, probs, n)
+
+	// the former modulo selection is detected as biased
+	rd := rand.New(rand.NewSource(42))
+	counts = make(map[string]float64)
+	for i := 0; i < n; i++ {
+		counts[string(alpha[rd.Intn(256)%26])]++
+	}
+	probs = make(map[string]float64)
+	for _, c := range alpha {
+		probs[string(c)] = 1. / 26
+	}
+	if chi2, crit := chiSquare(counts, probs, n); chi2 <= crit {
+		t.Fatalf("modulo selection should be detected as biased, chi-square %.1f", chi2)
+	}
+}
+
+func TestUniformWordList(t *testing.T) {
+	const n = 100_000
+	counts := sample(New(crypto.MD5, 10).CompileWordList("words_test.txt"), n)
+	probs := make(map[string]float64)
+	for w := range counts {
+		probs[w] = 1 / float64(len(counts))
+	}
+	checkDistribution(t, "words", counts, probs, n)
+}
+
+func TestUniformTransform(t *testing.T) {
+	const n = 100_000
+	var trf []func(p []byte) []byte
+	probs := make(map[string]float64)
+	for i := 0; i < 7; i++ {
+		s := string(rune('a' + i))
+		trf = append(trf, func(p []byte) []byte { return append(p, s...) })
+		probs[s] = 1. / 7
+	}
+	checkDistribution(t, "transforms", sample(New(crypto.MD5, 10).CompileTransform(trf...), n), probs, n)
+}
+
+func TestUniformReduce(t *testing.T) {
+	// the complete reduce function, applied to random hashes
+	const n = 200_000
+	r := New(crypto.MD5, 10).CompileAlphabet("abcdefghijklmnopqrstuvwxyz", 1, 1).CompileAlphabet("0123456", 1, 1)
+	red := r.buildReduce()
+	// the modules share the slack, and fit in the hash
+	if r.used != 2+entropySlack {
+		t.Fatalf("expected %d bytes of entropy, got %d", 2+entropySlack, r.used)
+	}
+	rd := rand.New(rand.NewSource(42))
+	h, p := make([]byte, 16), []byte{}
+	counts := make(map[string]float64)
+	for i := 0; i < n; i++ {
+		rd.Read(h)
+		p = red(i, h, p)
+		counts[string(p)]++
+	}
+	probs := make(map[string]float64)
+	for _, c := range "abcdefghijklmnopqrstuvwxyz" {
+		for _, d := range "0123456" {
+			probs[string(c)+string(d)] = 1. / 26 / 7
+		}
+	}
+	checkDistribution(t, "reduce", counts, probs, n)
+}
+
+func TestStretchedReduce(t *testing.T) {
+	// the first modules draw the 16 bytes of MD5, the last one
+	// draws bytes beyond the hash, which should not be copies
+	const n = 100_000
+	red := New(crypto.MD5, 10).CompileNumberRange(math.MinInt64, math.MaxInt64, 0).
+		CompileAlphabet("0123456789abcdef", 16, 16).CompileAlphabet("0123456789abcdef", 1, 1).buildReduce()
+	rd := rand.New(rand.NewSource(42))
+	h, p := make([]byte, 16), []byte{}
+	counts := make(map[string]float64)
+	for i := 0; i < n; i++ {
+		rd.Read(h)
+		p = red(3, h, p)
+		v, err := strconv.ParseInt(string(p[:len(p)-17]), 10, 64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// first hex digit of the number drawn, and the letter
+		counts[fmt.Sprintf("%x%c", uint64(v-math.MinInt64)>>60, p[len(p)-1])]++
+	}
+	probs := make(map[string]float64)
+	for _, a := range "0123456789abcdef" {
+		for _, b := range "0123456789abcdef" {
+			probs[string(a)+string(b)] = 1. / 256
+		}
+	}
+	checkDistribution(t, "stretched reduce", counts, probs, n)
+}
+
+// BenchmarkChainStep measures a reduce and hash step, with modules
+// needing a few bytes of entropy each.
+func BenchmarkChainStep(b *testing.B) {
+	for _, c := range []struct {
+		name string
+		r    *Rainbow
+	}{
+		{"alphabet", New(crypto.MD5, 1000).CompileAlphabet("abcdefghijklmnopqrstuvwxyz", 4, 8).Build()},
+		{"word+number", New(crypto.MD5, 1000).CompileWordList("words_test.txt").CompileNumberRange(0, 9999, 4).Build()},
+		{"word+rules+number+symbol", New(crypto.MD5, 1000).CompileWordList("words_test.txt").
+			CompileRuleList(":", "c", "u").CompileNumberRange(0, 9999, 4).CompileAlphabet("!@#$", 1, 1).Build()},
+	} {
+		b.Run(c.name, func(b *testing.B) {
+			h, p := make([]byte, 16), []byte{}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				p = c.r.rf(i%c.r.cl, h, p)
+				h = c.r.hf(p, h)
+			}
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package rainbow
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Errors reported when reading table or chain files.
+// They are wrapped with more context, use errors.Is to test for them.
+var (
+	// ErrBadMagic is reported when the file is not a table (or chain) file.
+	ErrBadMagic = errors.New("bad magic, not a rainbow file")
+	// ErrBadVersion is reported for an unsupported file format version.
+	ErrBadVersion = errors.New("unsupported file format version")
+	// ErrBadHeader is reported when header values are not sensible.
+	ErrBadHeader = errors.New("invalid header")
+	// ErrTruncated is reported when the file ends prematurely.
+	ErrTruncated = errors.New("file is truncated")
+	// ErrSignatureMismatch is reported when the file was produced
+	// with another configuration.
+	ErrSignatureMismatch = errors.New("signatures do not match")
+	// ErrCountMismatch is reported when the number of chains found
+	// does not match the number of chains declared.
+	ErrCountMismatch = errors.New("chain count does not match")
+	// ErrCorrupted is reported when checksums do not match,
+	// or when the chains are not properly sorted.
+	ErrCorrupted = errors.New("file is corrupted")
+)
+
+// Sane limits for header values, to avoid trusting arbitrary lengths.
+const (
+	// maximum length of a signature, in bytes
+	maxSignatureLen = 1 << 16
+	// maximum size of a hash, in bytes
+	maxHashSize = 64
+)
+
+// errorf wraps err with a formatted context message.
+func errorf(err error, format string, a ...interface{}) error {
+	return fmt.Errorf("%s : %w", fmt.Sprintf(format, a...), err)
+}
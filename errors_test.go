@@ -0,0 +1,123 @@
+package rainbow
+
+import (
+	"bytes"
+	"crypto"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadTypedErrors(t *testing.T) {
+	r := getTestRainbow(10)
+	for i := 0; i < 100; i++ {
+		r.AddChain(r.NewChain())
+	}
+	buf := new(bytes.Buffer)
+	r.Freeze().WriteTo(buf)
+	data := buf.Bytes()
+	hs := r.Freeze().fileHeader().size()
+
+	// a header declaring a huge signature
+	huge := append([]byte{}, data...)
+	mode.PutUint64(huge[48:56], 1<<40)
+
+	// a header declaring more chains than available
+	more := append([]byte{}, data...)
+	mode.PutUint64(more[16:24], 101)
+
+	// a flipped bit, with the right size
+	corrupted := append([]byte{}, data...)
+	corrupted[hs+40] ^= 1
+
+	cases := []struct {
+		name string
+		data []byte
+		err  error
+	}{
+		{"empty", []byte{}, ErrTruncated},
+		{"short header", data[:10], ErrTruncated},
+		{"short signature", data[:hs-3], ErrTruncated},
+		{"short chains", data[:hs+50*32+7], ErrTruncated},
+		{"bad magic", append([]byte("XXXX"), data[4:]...), ErrBadMagic},
+		{"huge signature", huge, ErrBadHeader},
+		{"more chains", more, ErrCountMismatch},
+		{"more chains, truncated", more[:len(more)-5], ErrTruncated},
+		{"corrupted chain", corrupted, ErrCorrupted},
+		{"trailing data", append(append([]byte{}, data...), 0), ErrCountMismatch},
+	}
+	for _, c := range cases {
+		rr := getTestRainbow(10)
+		e := rr.Load(bytes.NewReader(c.data))
+		if !errors.Is(e, c.err) {
+			t.Fatalf("%s : expected %v, got %v", c.name, c.err, e)
+		}
+		if len(rr.chains) != 0 {
+			t.Fatalf("%s : %d chains were added by a failed load", c.name, len(rr.chains))
+		}
+	}
+
+	// another configuration
+	rr := New(crypto.MD5, 10).CompileAlphabet("abc", 1, 2).Build()
+	if e := rr.Load(bytes.NewReader(data)); !errors.Is(e, ErrSignatureMismatch) {
+		t.Fatalf("expected %v, got %v", ErrSignatureMismatch, e)
+	}
+
+	// the same checks apply to mapped tables
+	fname := filepath.Join(t.TempDir(), "typed.rbw")
+	os.WriteFile(fname, append(append([]byte{}, data...), 0), 0644)
+	if _, e := getTestRainbow(10).OpenTable(fname); !errors.Is(e, ErrCountMismatch) {
+		t.Fatalf("expected %v, got %v", ErrCountMismatch, e)
+	}
+	os.WriteFile(fname, data[:len(data)-1], 0644)
+	if _, e := getTestRainbow(10).OpenTable(fname); !errors.Is(e, ErrTruncated) {
+		t.Fatalf("expected %v, got %v", ErrTruncated, e)
+	}
+	os.WriteFile(fname, huge, 0644)
+	if _, e := getTestRainbow(10).OpenTable(fname); !errors.Is(e, ErrBadHeader) {
+		t.Fatalf("expected %v, got %v", ErrBadHeader, e)
+	}
+}
+
+func FuzzLoad(f *testing.F) {
+	r := getTestRainbow(5)
+	for i := 0; i < 20; i++ {
+		r.AddChain(r.NewChain())
+	}
+	buf := new(bytes.Buffer)
+	r.Freeze().WriteTo(buf)
+	f.Add(buf.Bytes())
+	f.Add(buf.Bytes()[:100])
+	// declaring one more chain than held
+	more := append([]byte{}, buf.Bytes()...)
+	mode.PutUint64(more[16:24], 21)
+	f.Add(more)
+	zipped := new(bytes.Buffer)
+	r.Freeze().WriteCompressed(zipped)
+	f.Add(zipped.Bytes())
+	f.Add([]byte("RBWT"))
+	f.Add([]byte{})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		rr := getTestRainbow(5)
+		e := rr.Load(bytes.NewReader(data))
+		if e == nil {
+			// whatever was accepted must be a consistent table
+			if ee := Verify(bytes.NewReader(data)); ee != nil {
+				t.Fatalf("loaded a table that does not verify : %v", ee)
+			}
+			return
+		}
+		if len(rr.chains) != 0 {
+			t.Fatalf("%d chains were added by a failed load", len(rr.chains))
+		}
+		for _, target := range []error{ErrBadMagic, ErrBadVersion, ErrBadHeader, ErrTruncated,
+			ErrSignatureMismatch, ErrCountMismatch, ErrCorrupted} {
+			if errors.Is(e, target) {
+				return
+			}
+		}
+		t.Fatalf("untyped error : %v", e)
+	})
+}
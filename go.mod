@@ -1,3 +1,5 @@
 module github.com/xavier268/go-rainbow
 
-go 1.17
+go 1.18
+
+require golang.org/x/text v0.14.0
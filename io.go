@@ -1,9 +1,7 @@
 package rainbow
 
 import (
-	"bufio"
 	"encoding/binary"
-	"errors"
 	"fmt"
 	"io"
 )
@@ -15,96 +13,55 @@ func (r *Rainbow) checkSignature(s string) bool {
 	return s == r.signature
 }
 
-// Save rainbow table content
+// Save rainbow table content, using the table file format.
+// Chains are saved sorted and deduplicated,
+// so the file can later be opened with OpenTable.
 func (r *Rainbow) Save(writer io.Writer) error {
-	r.DedupChains()
-
-	// save signature-length and signature
-	buf := bufio.NewWriter(writer)
-	s := r.signature
-	if e := binary.Write(buf, mode, uint64(len(s))); e != nil {
-		return e
-	}
-	if _, e := buf.Write([]byte(s)); e != nil {
-		return e
-	}
-
-	// save nb of chains
-	binary.Write(buf, mode, uint64(len(r.chains)))
-
-	// save the chains
-	n := 0
-	for _, c := range r.chains {
-		if e := binary.Write(buf, mode, c.start); e != nil {
-			return e
-		}
-		if e := binary.Write(buf, mode, c.end); e != nil {
-			return e
-		}
-		n++
-		if n%1000 == 0 {
-			fmt.Println(n, "chains saved")
-		}
-	}
-	e := buf.Flush()
-	fmt.Println(n, "chains saved")
+	t := r.Freeze()
+	_, e := t.WriteTo(writer)
+	fmt.Println(t.Len(), "chains saved")
 	fmt.Println("Saved ", r.signature)
 	return e
 }
 
 // Load will load chains from the reader,
 // adding them to the existing rainbow table.
-// File compatibility is (approximately) verified.
+// File compatibility is (approximately) verified,
+// and file integrity is checked against the file checksums.
+// The reader should contain a single table file, nothing more.
+// Errors wrap one of the ErrXXX errors, such as ErrTruncated,
+// ErrBadMagic, ErrSignatureMismatch or ErrCountMismatch.
+// On error, no chains are added.
 func (r *Rainbow) Load(reader io.Reader) error {
 
-	buf := bufio.NewReader(reader)
-
-	// read and check signature
-	var sl uint64
-	if e := binary.Read(buf, mode, &sl); e != nil {
+	// read and check header
+	tr, e := newTableReader("table", reader)
+	if e != nil {
 		return e
 	}
-	bb := make([]byte, sl)
-	if _, e := buf.Read(bb); e != nil {
+	if e = r.checkFileHeader(tr.fh); e != nil {
 		return e
 	}
-	if r.signature != string(bb) {
-		return errors.New("Cannot load because signatures do not match")
-	}
-
-	// read nb of chains
-	var nb uint64
-	binary.Read(buf, mode, &nb)
-	// read chains
-	var e error
 
-	for n := uint64(0); e == nil && n < nb; n++ {
-
-		start := make([]byte, r.hsize)
-		end := make([]byte, r.hsize)
-		if e = binary.Read(buf, mode, start); e != nil {
-			break
-		}
-		if e = binary.Read(buf, mode, end); e != nil {
-			break
+	// read chains, adding them once the whole file is verified
+	w := r.walker()
+	var chains []*Chain
+	for n := 1; tr.rec != nil; n++ {
+		chains = append(chains, w.chainOf(tr.rec))
+		if n%1000 == 0 {
+			fmt.Println(n, "chains loaded")
 		}
-		c := new(Chain)
-		c.start = start
-		c.end = end
-		r.AddChain(c)
-		if (n+1)%1000 == 0 || e != nil {
-			fmt.Println(n+1, "chains loaded")
+		if e = tr.next(); e != nil {
+			return e
 		}
 	}
+	if e = tr.checkEOF(); e != nil {
+		return e
+	}
+	r.AddChain(chains...)
 
 	// Dedup (and sort) when finished loading.
 	r.DedupChains()
 
-	// ignore eof
-	if e == io.EOF {
-		return nil
-	}
-
-	// unexpected errors
-	return e
+	return nil
 }
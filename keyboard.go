@@ -0,0 +1,281 @@
+package rainbow
+
+import (
+	"fmt"
+	"math"
+)
+
+// Keyboards are described by rows of keys, unshifted then shifted,
+// each row being shifted half a key to the right of the row above,
+// as on a staggered keyboard. Spaces stand for missing keys, aligning
+// rows so that the key at column c of a row sits between the keys at
+// columns c and c+1 of the row above, as q sits between 1 and 2.
+type keyboardLayout struct {
+	keys, shifted []string
+}
+
+// keyboardLayouts are the built-in layouts, by name.
+var keyboardLayouts = map[string]keyboardLayout{
+	"qwerty": {
+		keys:    []string{"`1234567890-=", " qwertyuiop[]\\", " asdfghjkl;'", " zxcvbnm,./"},
+		shifted: []string{"~!@#$%^&*()_+", " QWERTYUIOP{}|", " ASDFGHJKL:\"", " ZXCVBNM<>?"},
+	},
+	"azerty": {
+		keys:    []string{"²&é\"'(-è_çà)=", " azertyuiop^$", " qsdfghjklmù*", "<wxcvbn,;:!"},
+		shifted: []string{"²1234567890°+", " AZERTYUIOP¨£", " QSDFGHJKLM%µ", ">WXCVBN?./§"},
+	},
+	"qwertz": {
+		keys:    []string{"^1234567890ß´", " qwertzuiopü+", " asdfghjklöä#", "<yxcvbnm,.-"},
+		shifted: []string{"°!\"§$%&/()=?`", " QWERTZUIOPÜ*", " ASDFGHJKLÖÄ'", ">YXCVBNM;:_"},
+	},
+}
+
+// WalkDirection is a set of keyboard walk directions.
+type WalkDirection uint8
+
+// Keyboard walk directions, to be combined.
+const (
+	WalkRight WalkDirection = 1 << iota
+	WalkLeft
+	WalkUpRight
+	WalkUpLeft
+	WalkDownRight
+	WalkDownLeft
+	// WalkAll allows every direction
+	WalkAll = WalkRight | WalkLeft | WalkUpRight | WalkUpLeft | WalkDownRight | WalkDownLeft
+)
+
+// row and column moves of each direction, in the order of the constants
+var walkMoves = [][2]int{{0, 1}, {0, -1}, {-1, 1}, {-1, 0}, {1, 0}, {1, -1}}
+
+// maximum number of distinct walks a keyboard walk module enumerates
+const maxWalks = 1 << 24
+
+// KeyboardWalkOptions controls the walks of CompileKeyboardWalk.
+// The options may allow at most 2^24 distinct walks, not counting
+// shifted walks and segments : CompileKeyboardWalk panics beyond.
+type KeyboardWalkOptions struct {
+	// Layout is "qwerty", the default, "azerty" or "qwertz".
+	Layout string
+	// MinLen and MaxLen bound the number of keys of each walk,
+	// at least 2.
+	MinLen, MaxLen int
+	// Directions allowed, all of them if 0.
+	Directions WalkDirection
+	// MaxTurns is the maximum number of direction changes of each walk.
+	MaxTurns int
+	// Shift types each walk with, or without, the shift key.
+	Shift bool
+	// Segments is the number of walks, 1 if 0. For instance,
+	// "1qaz2wsx" is made of 2 straight walks of 4 keys.
+	Segments int
+}
+
+// keyboardGrid is a keyboard layout, by row and column.
+type keyboardGrid struct {
+	keys, shifted [][]rune
+}
+
+// newKeyboardGrid returns the grid of a known layout.
+func newKeyboardGrid(layout string) *keyboardGrid {
+	l := keyboardLayouts[layout]
+	g := &keyboardGrid{keys: make([][]rune, len(l.keys)), shifted: make([][]rune, len(l.keys))}
+	for i := range l.keys {
+		g.keys[i], g.shifted[i] = []rune(l.keys[i]), []rune(l.shifted[i])
+		if len(g.keys[i]) != len(g.shifted[i]) {
+			panic("inconsistent keyboard layout")
+		}
+	}
+	return g
+}
+
+// key reports whether there is a key at row r, column c.
+func (g *keyboardGrid) key(r, c int) bool {
+	return r >= 0 && r < len(g.keys) && c >= 0 && c < len(g.keys[r]) && g.keys[r][c] != ' '
+}
+
+// countKeyboardWalks counts the distinct walks allowed by opt, without
+// enumerating them, by length, then by key, direction and turns.
+// Counting stops as soon as there are more than max walks.
+func countKeyboardWalks(opt KeyboardWalkOptions, max float64) float64 {
+	g := newKeyboardGrid(opt.Layout)
+	cols := 0
+	for _, row := range g.keys {
+		if len(row) > cols {
+			cols = len(row)
+		}
+	}
+	// turns are bounded by the number of moves
+	turns := opt.MaxTurns
+	if turns > opt.MaxLen {
+		turns = opt.MaxLen
+	}
+	// walks of the current length, by last key, last direction and turns,
+	// the first direction being len(walkMoves)
+	state := func(r, c, dir, t int) int {
+		return ((r*cols+c)*(len(walkMoves)+1)+dir)*(turns+1) + t
+	}
+	size := len(g.keys) * cols * (len(walkMoves) + 1) * (turns + 1)
+	walks := make([]float64, size)
+	for r := range g.keys {
+		for c := range g.keys[r] {
+			if g.key(r, c) {
+				walks[state(r, c, len(walkMoves), 0)] = 1
+			}
+		}
+	}
+
+	var total float64
+	for length := 1; ; length++ {
+		if length >= opt.MinLen {
+			for _, w := range walks {
+				total += w
+			}
+			if total > max {
+				return total
+			}
+		}
+		if length == opt.MaxLen {
+			return total
+		}
+		next := make([]float64, size)
+		more := false
+		for r := range g.keys {
+			for c := range g.keys[r] {
+				for dir := 0; dir <= len(walkMoves); dir++ {
+					for t := 0; t <= turns; t++ {
+						w := walks[state(r, c, dir, t)]
+						if w == 0 {
+							continue
+						}
+						for d, m := range walkMoves {
+							tt := t
+							if dir < len(walkMoves) && d != dir {
+								tt++
+							}
+							if opt.Directions&(1<<d) == 0 || tt > turns || !g.key(r+m[0], c+m[1]) {
+								continue
+							}
+							next[state(r+m[0], c+m[1], d, tt)] += w
+							more = true
+						}
+					}
+				}
+			}
+		}
+		if !more {
+			return total
+		}
+		walks = next
+	}
+}
+
+// keyboardWalks enumerates the distinct walks allowed by opt,
+// unshifted, then shifted. The layout should be known, and the number
+// of walks checked with countKeyboardWalks.
+func keyboardWalks(opt KeyboardWalkOptions) (plain, shifted *wordArena) {
+	g := newKeyboardGrid(opt.Layout)
+	grid, shift, key := g.keys, g.shifted, g.key
+
+	plain, shifted = newWordArena(), newWordArena()
+	var rows, cols []int
+	var walk func(dir, turns int)
+	walk = func(dir, turns int) {
+		if len(rows) >= opt.MinLen {
+			var p, s []byte
+			for i := range rows {
+				p = append(p, string(grid[rows[i]][cols[i]])...)
+				s = append(s, string(shift[rows[i]][cols[i]])...)
+			}
+			plain.add(p)
+			shifted.add(s)
+		}
+		if len(rows) == opt.MaxLen {
+			return
+		}
+		r, c := rows[len(rows)-1], cols[len(cols)-1]
+		for d, m := range walkMoves {
+			t := turns
+			if dir >= 0 && d != dir {
+				t++
+			}
+			if opt.Directions&(1<<d) == 0 || t > opt.MaxTurns || !key(r+m[0], c+m[1]) {
+				continue
+			}
+			rows, cols = append(rows, r+m[0]), append(cols, c+m[1])
+			walk(d, t)
+			rows, cols = rows[:len(rows)-1], cols[:len(cols)-1]
+		}
+	}
+	for r := range grid {
+		for c := range grid[r] {
+			if key(r, c) {
+				rows, cols = []int{r}, []int{c}
+				walk(-1, 0)
+			}
+		}
+	}
+	return plain, shifted
+}
+
+// CompileKeyboardWalk appends keyboard walks, such as "qwerty",
+// "zxcvbn", or "1qaz2wsx" made of 2 walks. A walk starts from any key,
+// then moves to a neighbouring key, left or right on the same row, or
+// to either key touching it on the row above or below. It changes
+// direction at most MaxTurns times. Every walk allowed by the options
+// is as likely, and so is shifting it or not. Name space estimations
+// count each sequence of walks once, though segments of different
+// lengths may join into the same password.
+func (r *Rainbow) CompileKeyboardWalk(opt KeyboardWalkOptions) *Rainbow {
+	if opt.MinLen < 2 || opt.MaxLen < opt.MinLen || opt.MaxTurns < 0 || opt.Segments < 0 {
+		panic("invalid input parameters")
+	}
+	if opt.Layout == "" {
+		opt.Layout = "qwerty"
+	}
+	if _, ok := keyboardLayouts[opt.Layout]; !ok {
+		panic(fmt.Sprintf("unknown keyboard layout %q", opt.Layout))
+	}
+	if opt.Directions == 0 {
+		opt.Directions = WalkAll
+	}
+	segments := opt.Segments
+	if segments == 0 {
+		segments = 1
+	}
+	switch count := countKeyboardWalks(opt, maxWalks); {
+	case count == 0:
+		panic("no keyboard walk matches the options")
+	case count > maxWalks:
+		panic("too many keyboard walks, reduce the length or the turns")
+	}
+	plain, shifted := keyboardWalks(opt)
+	n := uint64(plain.len())
+	choices := float64(n)
+	if opt.Shift {
+		choices *= 2
+	}
+	size := math.Pow(choices, float64(segments))
+
+	mod := new(rmodule)
+	mod.signature = fmt.Sprintf("CompileKeyboardWalk on %s, length %d to %d, directions %06b, turns %d, shift %v, segments %d",
+		opt.Layout, opt.MinLen, opt.MaxLen, opt.Directions, opt.MaxTurns, opt.Shift, segments)
+	mod.classes = []pclass{{p: 1 / size, n: size}}
+	mod.bytes = entropyBytes(size)
+	mod.run = func(d *drawer, p []byte) []byte {
+		for s := 0; s < segments; s++ {
+			i := int(d.draw(n))
+			if opt.Shift && d.draw(2) == 1 {
+				p = append(p, shifted.word(i)...)
+			} else {
+				p = append(p, plain.word(i)...)
+			}
+		}
+		return p
+	}
+
+	// append the module
+	r.rms = append(r.rms, mod)
+
+	return r
+}
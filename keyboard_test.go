@@ -0,0 +1,105 @@
+package rainbow
+
+import (
+	"crypto"
+	"testing"
+)
+
+func TestKeyboardWalks(t *testing.T) {
+	plain, shifted := keyboardWalks(KeyboardWalkOptions{Layout: "qwerty", MinLen: 2, MaxLen: 6, Directions: WalkAll})
+	walks := make(map[string]string)
+	for i := 0; i < plain.len(); i++ {
+		walks[string(plain.word(i))] = string(shifted.word(i))
+	}
+	for w, s := range map[string]string{"qwerty": "QWERTY", "zxcvbn": "ZXCVBN", "1qaz": "!QAZ", "poiuy": "POIUY", "mju7": "MJU&", "`1": "~!"} {
+		if walks[w] != s {
+			t.Fatalf("walk %q should be found, shifted as %q", w, s)
+		}
+	}
+	for _, w := range []string{"qwrt", "qaw", "q", "qwertyu", "1q2"} {
+		if _, ok := walks[w]; ok {
+			t.Fatalf("walk %q should not be found", w)
+		}
+	}
+
+	// turns
+	plain, _ = keyboardWalks(KeyboardWalkOptions{Layout: "qwerty", MinLen: 3, MaxLen: 4, Directions: WalkAll, MaxTurns: 1})
+	found := make(map[string]bool)
+	for i := 0; i < plain.len(); i++ {
+		found[string(plain.word(i))] = true
+	}
+	if !found["qaw"] || !found["qwsx"] || found["qawe"] {
+		t.Fatal("unexpected walks with a turn")
+	}
+
+	// other layouts
+	for layout, w := range map[string]string{"azerty": "azerty", "qwertz": "yxcvb"} {
+		plain, _ = keyboardWalks(KeyboardWalkOptions{Layout: layout, MinLen: 5, MaxLen: 6, Directions: WalkRight})
+		found = make(map[string]bool)
+		for i := 0; i < plain.len(); i++ {
+			found[string(plain.word(i))] = true
+		}
+		if !found[w] {
+			t.Fatalf("walk %q should be found on %s", w, layout)
+		}
+	}
+}
+
+func TestCountKeyboardWalks(t *testing.T) {
+	for _, opt := range []KeyboardWalkOptions{
+		{Layout: "qwerty", MinLen: 2, MaxLen: 6, Directions: WalkAll},
+		{Layout: "qwerty", MinLen: 3, MaxLen: 7, Directions: WalkAll, MaxTurns: 2},
+		{Layout: "azerty", MinLen: 4, MaxLen: 5, Directions: WalkRight | WalkDownLeft, MaxTurns: 1},
+		{Layout: "qwertz", MinLen: 12, MaxLen: 20, Directions: WalkLeft},
+	} {
+		plain, _ := keyboardWalks(opt)
+		if n := countKeyboardWalks(opt, maxWalks); n != float64(plain.len()) {
+			t.Fatalf("%+v : counted %v walks, enumerated %d", opt, n, plain.len())
+		}
+	}
+
+	// counting stops beyond the limit, before enumerating anything
+	opt := KeyboardWalkOptions{Layout: "qwerty", MinLen: 2, MaxLen: 1_000, Directions: WalkAll, MaxTurns: 1_000}
+	if n := countKeyboardWalks(opt, maxWalks); n <= maxWalks {
+		t.Fatalf("expected more than %d walks, got %v", maxWalks, n)
+	}
+	defer func() {
+		if recover() == nil {
+			t.Fatal("too many walks should be rejected")
+		}
+	}()
+	New(crypto.MD5, 10).CompileKeyboardWalk(opt)
+}
+
+func TestCompileKeyboardWalk(t *testing.T) {
+	// 3 keys to the right, on 4 rows of 13, 13, 11 and 10 keys
+	r := New(crypto.MD5, 10).CompileKeyboardWalk(KeyboardWalkOptions{MinLen: 3, MaxLen: 3, Directions: WalkRight, Shift: true})
+	if s := r.NamespaceSize(); s != 2*(11+11+9+8) {
+		t.Fatalf("expected %d walks, got %v", 2*(11+11+9+8), s)
+	}
+	counts := sample(r, 20_000)
+	probs := make(map[string]float64)
+	for w := range counts {
+		probs[w] = 1. / 78
+	}
+	if len(counts) != 78 || counts["qwe"] == 0 || counts["!@#"] == 0 {
+		t.Fatalf("unexpected walks %v", counts)
+	}
+	checkDistribution(t, "keyboard walks", counts, probs, 20_000)
+
+	// two walks
+	r = New(crypto.MD5, 10).CompileKeyboardWalk(KeyboardWalkOptions{MinLen: 4, MaxLen: 4, Directions: WalkDownRight, Segments: 2})
+	if s := r.NamespaceSize(); s != 10*10 {
+		t.Fatalf("expected %d passwords, got %v", 100, s)
+	}
+	if counts = sample(r, 2_000); counts["1qaz2wsx"] == 0 {
+		t.Fatalf("1qaz2wsx not found in %v", counts)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("unknown layouts should be rejected")
+		}
+	}()
+	New(crypto.MD5, 10).CompileKeyboardWalk(KeyboardWalkOptions{Layout: "dvorak", MinLen: 2, MaxLen: 3})
+}
@@ -0,0 +1,112 @@
+package rainbow
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// CompileAlphabetUniform is like CompileAlphabet, but chooses the
+// length with a probability proportional to the number of strings of
+// that length, so that all the strings between min and max runes are
+// equally likely. CompileAlphabet instead gives each length the same
+// probability, favouring short strings.
+func (r *Rainbow) CompileAlphabetUniform(alphabet string, min, max int) *Rainbow {
+	if len(alphabet) == 0 || max < min || max <= 0 || min < 0 {
+		panic("invalid input parameters")
+	}
+	a := float64(len(alphabetSigns(alphabet)))
+	weights := make(map[int]float64)
+	for l := min; l <= max; l++ {
+		// relative to the longest strings, to avoid overflows
+		weights[l] = math.Pow(a, float64(l-max))
+	}
+	sig := fmt.Sprintf("CompileAlphabetUniform with alphabet : %v, min:%d, max:%d", alphabet, min, max)
+	return r.compileAlphabetLengths(alphabet, weights, sig)
+}
+
+// CompileAlphabetLengths is like CompileAlphabet, but chooses the
+// length of the appended string with a custom distribution.
+// The keys of weights are the possible lengths, in runes, and its values
+// their relative weights. Lengths with a zero weight are never chosen.
+func (r *Rainbow) CompileAlphabetLengths(alphabet string, weights map[int]float64) *Rainbow {
+	sig := fmt.Sprintf("CompileAlphabetLengths with alphabet : %v, weights:%v", alphabet, weights)
+	return r.compileAlphabetLengths(alphabet, weights, sig)
+}
+
+// compileAlphabetLengths compiles an alphabet module, choosing
+// the length according to weights.
+func (r *Rainbow) compileAlphabetLengths(alphabet string, weights map[int]float64, sig string) *Rainbow {
+
+	if len(alphabet) == 0 {
+		panic("invalid input parameters")
+	}
+	alp := alphabetSigns(alphabet)
+
+	// lengths, and their probabilities
+	var lengths []int
+	var total float64
+	for l, w := range weights {
+		if l < 0 || w < 0 || math.IsInf(w, 0) || math.IsNaN(w) {
+			panic("invalid length weights")
+		}
+		if w > 0 {
+			lengths = append(lengths, l)
+			total += w
+		}
+	}
+	if len(lengths) == 0 {
+		panic("at least one length should have a positive weight")
+	}
+	sort.Ints(lengths)
+	max := lengths[len(lengths)-1]
+
+	probs := make([]float64, len(lengths))
+	for i, l := range lengths {
+		probs[i] = weights[l] / total
+	}
+	cumul := thresholds64(probs)
+
+	mod := new(rmodule)
+	mod.signature = sig
+	// 64 bits for the size, and one choice per letter
+	mod.bytes = 8 + entropyBytes(math.Pow(float64(len(alp)), float64(max)))
+	for _, l := range lengths {
+		n := math.Pow(float64(len(alp)), float64(l))
+		mod.classes = append(mod.classes, pclass{p: weights[l] / total / n, n: n})
+	}
+	mod.classes = compactClasses(mod.classes)
+	mod.run = func(d *drawer, p []byte) []byte {
+		// decide on the size, the last length takes what remains
+		x := d.draw64()
+		i := sort.Search(len(cumul)-1, func(i int) bool { return x < cumul[i] })
+		s := lengths[i]
+
+		// append values to p
+		for i := 0; i < s; i++ {
+			p = append(p, alp[d.draw(uint64(len(alp)))]...)
+		}
+		return p
+	}
+
+	// append the rmodule
+	r.rms = append(r.rms, mod)
+
+	return r
+}
+
+// thresholds64 returns the cumulated probabilities, scaled to 2^64,
+// to select a value from a draw64 with sort.Search.
+func thresholds64(probs []float64) []uint64 {
+	cumul := make([]uint64, len(probs))
+	var sum float64
+	for i, p := range probs {
+		sum += p
+		if s := math.Ldexp(sum, 64); s < math.MaxUint64 {
+			cumul[i] = uint64(s)
+		} else {
+			cumul[i] = math.MaxUint64
+		}
+	}
+	return cumul
+}
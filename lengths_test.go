@@ -0,0 +1,61 @@
+package rainbow
+
+import (
+	"crypto"
+	"math"
+	"strconv"
+	"testing"
+)
+
+// lengthCounts counts the lengths of the passwords produced by r.
+func lengthCounts(r *Rainbow, n int) map[string]float64 {
+	counts := make(map[string]float64)
+	for p, c := range sample(r, n) {
+		counts[strconv.Itoa(len(p))] += c
+	}
+	return counts
+}
+
+func TestCompileAlphabetUniform(t *testing.T) {
+	const n = 100_000
+	r := New(crypto.MD5, 10).CompileAlphabetUniform("abc", 1, 4)
+	probs := map[string]float64{"1": 3. / 120, "2": 9. / 120, "3": 27. / 120, "4": 81. / 120}
+	checkDistribution(t, "uniform lengths", lengthCounts(r, n), probs, n)
+
+	// all strings are equally likely
+	if ns, eff := r.NamespaceSize(), r.EffectiveNamespaceSize(); ns != 120 || math.Abs(eff-ns) > 1e-6 {
+		t.Fatalf("expected a name space of 120, got %v, effective %v", ns, eff)
+	}
+	probs = make(map[string]float64)
+	for p := range sample(r, n) {
+		probs[p] = 1. / 120
+	}
+	if len(probs) != 120 {
+		t.Fatalf("expected 120 distinct strings, got %d", len(probs))
+	}
+	checkDistribution(t, "uniform strings", sample(r, n), probs, n)
+
+	// large name spaces do not overflow
+	big := New(crypto.MD5, 10).CompileAlphabetUniform("abcdefghijklmnopqrstuvwxyz0123456789", 1, 20)
+	for l, c := range lengthCounts(big, 10_000) {
+		if l != "20" && l != "19" && l != "18" {
+			t.Fatalf("unexpected length %s, %v times", l, c)
+		}
+	}
+}
+
+func TestCompileAlphabetLengths(t *testing.T) {
+	const n = 100_000
+	r := New(crypto.MD5, 10).CompileAlphabetLengths("xyz", map[int]float64{2: 1, 5: 3, 7: 0})
+	checkDistribution(t, "custom lengths", lengthCounts(r, n), map[string]float64{"2": 0.25, "5": 0.75}, n)
+	if ns := r.NamespaceSize(); ns != 9+243 {
+		t.Fatalf("expected a name space of 252, got %v", ns)
+	}
+
+	// weights are part of the signature
+	a := New(crypto.MD5, 10).CompileAlphabetLengths("xyz", map[int]float64{2: 1, 5: 3}).Build()
+	b := New(crypto.MD5, 10).CompileAlphabetLengths("xyz", map[int]float64{2: 1, 5: 2}).Build()
+	if a.signature == b.signature {
+		t.Fatal("signatures should differ")
+	}
+}
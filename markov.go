@@ -0,0 +1,413 @@
+package rainbow
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// A Markov model gives, for each context, the counts of the runes
+// following it in a training word list. The context is the previous rune,
+// or the start of the word, and optionally the position in the word,
+// as in hashcat Markov mode. Positions beyond markovPositions share
+// the last position. The model also counts the word lengths, in runes.
+
+// number of positions distinguished by per position models
+const markovPositions = 32
+
+// version of the model file format
+const markovVersion = 1
+
+// markovContext identifies a transition table.
+type markovContext struct {
+	// position in the word, 0 when the model is not per position
+	pos int
+	// previous rune, -1 at the start of the word
+	prev rune
+}
+
+// MarkovModel holds the rune transition counts learnt from a word list.
+type MarkovModel struct {
+	perPosition bool
+	lengths     map[int]uint64
+	counts      map[markovContext]map[rune]uint64
+}
+
+// TrainMarkov learns a Markov model from a word list, one word per line.
+// With perPosition, transitions are counted separately for each position,
+// otherwise only the previous rune matters.
+// Empty lines are ignored.
+func TrainMarkov(reader io.Reader, perPosition bool) (*MarkovModel, error) {
+	m := &MarkovModel{
+		perPosition: perPosition,
+		lengths:     make(map[int]uint64),
+		counts:      make(map[markovContext]map[rune]uint64),
+	}
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		word := strings.TrimRight(scanner.Text(), "\r")
+		if word == "" {
+			continue
+		}
+		pos, prev := 0, rune(-1)
+		for _, c := range word {
+			m.add(markovContext{pos: m.slot(pos), prev: prev}, c, 1)
+			pos++
+			prev = c
+		}
+		m.lengths[pos]++
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(m.lengths) == 0 {
+		return nil, fmt.Errorf("no words to train the Markov model")
+	}
+	return m, nil
+}
+
+// slot is the transition table position for position pos.
+func (m *MarkovModel) slot(pos int) int {
+	switch {
+	case !m.perPosition:
+		return 0
+	case pos >= markovPositions:
+		return markovPositions - 1
+	}
+	return pos
+}
+
+// add adds n to the count of c following ctx.
+func (m *MarkovModel) add(ctx markovContext, c rune, n uint64) {
+	next := m.counts[ctx]
+	if next == nil {
+		next = make(map[rune]uint64)
+		m.counts[ctx] = next
+	}
+	next[c] += n
+}
+
+// markovFile is the serialized form of a MarkovModel.
+type markovFile struct {
+	Version     int
+	PerPosition bool
+	Lengths     map[int]uint64
+	Transitions []markovTransition
+}
+
+// markovTransition holds the counts of the runes following
+// the previous rune Prev, empty at the start of the word.
+type markovTransition struct {
+	Pos  int
+	Prev string
+	Next map[string]uint64
+}
+
+// WriteTo saves the model to w, as JSON.
+func (m *MarkovModel) WriteTo(w io.Writer) (int64, error) {
+	mf := markovFile{Version: markovVersion, PerPosition: m.perPosition, Lengths: m.lengths}
+	for ctx, next := range m.counts {
+		t := markovTransition{Pos: ctx.pos, Next: make(map[string]uint64, len(next))}
+		if ctx.prev >= 0 {
+			t.Prev = string(ctx.prev)
+		}
+		for c, n := range next {
+			t.Next[string(c)] = n
+		}
+		mf.Transitions = append(mf.Transitions, t)
+	}
+	sort.Slice(mf.Transitions, func(i, j int) bool {
+		a, b := mf.Transitions[i], mf.Transitions[j]
+		return a.Pos < b.Pos || (a.Pos == b.Pos && a.Prev < b.Prev)
+	})
+	data, err := json.MarshalIndent(mf, "", " ")
+	if err != nil {
+		return 0, err
+	}
+	n, err := w.Write(append(data, '\n'))
+	return int64(n), err
+}
+
+// ReadMarkovModel reads a model saved by WriteTo.
+// Errors wrap ErrCorrupted when the model is invalid.
+func ReadMarkovModel(reader io.Reader) (*MarkovModel, error) {
+	var mf markovFile
+	if err := json.NewDecoder(reader).Decode(&mf); err != nil {
+		return nil, errorf(ErrCorrupted, "cannot decode Markov model : %v", err)
+	}
+	if mf.Version != markovVersion {
+		return nil, errorf(ErrCorrupted, "unsupported Markov model version %d", mf.Version)
+	}
+	m := &MarkovModel{
+		perPosition: mf.PerPosition,
+		lengths:     make(map[int]uint64),
+		counts:      make(map[markovContext]map[rune]uint64),
+	}
+	for l, n := range mf.Lengths {
+		if l < 0 {
+			return nil, errorf(ErrCorrupted, "invalid length %d", l)
+		}
+		if n > 0 {
+			m.lengths[l] = n
+		}
+	}
+	if len(m.lengths) == 0 {
+		return nil, errorf(ErrCorrupted, "no lengths in Markov model")
+	}
+	for _, t := range mf.Transitions {
+		ctx := markovContext{pos: t.Pos, prev: -1}
+		if t.Pos < 0 || t.Pos >= markovPositions || (!m.perPosition && t.Pos != 0) {
+			return nil, errorf(ErrCorrupted, "invalid position %d", t.Pos)
+		}
+		if t.Prev != "" {
+			if ctx.prev = singleRune(t.Prev); ctx.prev < 0 {
+				return nil, errorf(ErrCorrupted, "invalid previous rune %q", t.Prev)
+			}
+		}
+		for s, n := range t.Next {
+			c := singleRune(s)
+			if c < 0 {
+				return nil, errorf(ErrCorrupted, "invalid rune %q", s)
+			}
+			if n > 0 {
+				m.add(ctx, c, n)
+			}
+		}
+	}
+	return m, nil
+}
+
+// singleRune returns the only rune of s, or -1.
+func singleRune(s string) rune {
+	c, size := utf8.DecodeRuneInString(s)
+	if size == 0 || size != len(s) {
+		return -1
+	}
+	return c
+}
+
+// markovTable selects the rune following a context.
+type markovTable struct {
+	// selected runes, as alphabet indexes, most frequent first
+	idx []int
+	// cumulated counts, and their total
+	cumul []uint64
+	total uint64
+}
+
+// newMarkovTable builds the table for the counts of next,
+// keeping the topN most frequent runes when topN is positive.
+func newMarkovTable(next map[rune]uint64, index map[rune]int, topN int) *markovTable {
+	runes := make([]rune, 0, len(next))
+	for c := range next {
+		runes = append(runes, c)
+	}
+	sort.Slice(runes, func(i, j int) bool {
+		a, b := next[runes[i]], next[runes[j]]
+		return a > b || (a == b && runes[i] < runes[j])
+	})
+	if topN > 0 && len(runes) > topN {
+		runes = runes[:topN]
+	}
+	t := new(markovTable)
+	for _, c := range runes {
+		t.total += next[c]
+		t.idx = append(t.idx, index[c])
+		t.cumul = append(t.cumul, t.total)
+	}
+	return t
+}
+
+// choose selects a rune from d, returning its alphabet index.
+func (t *markovTable) choose(d *drawer) int {
+	v := d.draw(t.total)
+	i := sort.Search(len(t.cumul)-1, func(i int) bool { return v < t.cumul[i] })
+	return t.idx[i]
+}
+
+// CompileMarkov appends a string of min to max runes, drawn from
+// a Markov model : each rune is drawn with the probability it follows
+// the previous rune, and the position when the model is per position,
+// in the training word list. With topN positive, only the topN most
+// frequent runes of each context are kept, as in OMEN or hashcat Markov
+// mode, to spend the table coverage on the most plausible strings.
+// The length follows the distribution of the training word lengths,
+// restricted to min..max, or is uniform if no training word fits.
+// Contexts never seen in training use the overall rune frequencies.
+func (r *Rainbow) CompileMarkov(m *MarkovModel, min, max, topN int) *Rainbow {
+	if m == nil || max < min || max <= 0 || min < 0 || topN < 0 {
+		panic("invalid input parameters")
+	}
+
+	// alphabet of the model, and overall frequencies
+	all := make(map[rune]uint64)
+	for _, next := range m.counts {
+		for c, n := range next {
+			all[c] += n
+		}
+	}
+	if len(all) == 0 {
+		panic("the Markov model has no transitions")
+	}
+	var alphabet []rune
+	for c := range all {
+		alphabet = append(alphabet, c)
+	}
+	sort.Slice(alphabet, func(i, j int) bool { return alphabet[i] < alphabet[j] })
+	alp := make([][]byte, len(alphabet))
+	index := make(map[rune]int, len(alphabet))
+	for i, c := range alphabet {
+		alp[i] = []byte(string(c))
+		index[c] = i
+	}
+
+	// tables[slot][prev+1], prev being an alphabet index, or -1 at the start
+	fallback := newMarkovTable(all, index, topN)
+	slots := 1
+	if m.perPosition {
+		slots = markovPositions
+	}
+	tables := make([][]*markovTable, slots)
+	for s := range tables {
+		tables[s] = make([]*markovTable, len(alphabet)+1)
+		for i := range tables[s] {
+			tables[s][i] = fallback
+		}
+	}
+	for ctx, next := range m.counts {
+		prev := 0
+		if ctx.prev >= 0 {
+			prev = index[ctx.prev] + 1
+		}
+		tables[ctx.pos][prev] = newMarkovTable(next, index, topN)
+	}
+	table := func(pos, prev int) *markovTable {
+		return tables[m.slot(pos)][prev]
+	}
+
+	// lengths, and their probabilities
+	var lengths []int
+	var probs []float64
+	var total float64
+	for l := min; l <= max; l++ {
+		total += float64(m.lengths[l])
+	}
+	for l := min; l <= max; l++ {
+		switch {
+		case total == 0:
+			probs = append(probs, 1/float64(max-min+1))
+		case m.lengths[l] > 0:
+			probs = append(probs, float64(m.lengths[l])/total)
+		default:
+			continue
+		}
+		lengths = append(lengths, l)
+	}
+	cumul := thresholds64(probs)
+
+	// entropy, 64 bits for the length, then enough for the largest
+	// table of each position
+	var bits float64
+	for pos := 0; pos < lengths[len(lengths)-1]; pos++ {
+		var largest uint64
+		for _, t := range tables[m.slot(pos)] {
+			if t.total > largest {
+				largest = t.total
+			}
+		}
+		bits += math.Log2(float64(largest))
+	}
+
+	digest := sha256.New()
+	m.WriteTo(digest)
+
+	mod := new(rmodule)
+	mod.signature = fmt.Sprintf("CompileMarkov with model digest %x, min:%d, max:%d, top:%d", digest.Sum(nil)[:8], min, max, topN)
+	mod.bytes = 8 + int(math.Ceil(bits/8))
+	mod.classes = markovClasses(lengths, probs, len(alphabet), table)
+	mod.run = func(d *drawer, p []byte) []byte {
+		// decide on the size, the last length takes what remains
+		x := d.draw64()
+		s := lengths[sort.Search(len(cumul)-1, func(i int) bool { return x < cumul[i] })]
+
+		// append runes to p
+		prev := 0
+		for i := 0; i < s; i++ {
+			c := table(i, prev).choose(d)
+			p = append(p, alp[c]...)
+			prev = c + 1
+		}
+		return p
+	}
+
+	// append the rmodule
+	r.rms = append(r.rms, mod)
+
+	return r
+}
+
+// markovClasses computes the classes of the strings drawn by a Markov
+// module, following the probabilities of the prefixes ending with each
+// rune, position after position. Classes are merged coarsely at each
+// position, to keep the computation short.
+func markovClasses(lengths []int, probs []float64, runes int, table func(pos, prev int) *markovTable) []pclass {
+	var classes []pclass
+	// prefixes[prev+1] are the classes of the prefixes ending with prev
+	prefixes := make([][]pclass, runes+1)
+	prefixes[0] = []pclass{{p: 1, n: 1}}
+	li := 0
+	for pos := 0; ; pos++ {
+		if lengths[li] == pos {
+			for _, pp := range prefixes {
+				for _, c := range pp {
+					classes = append(classes, pclass{p: c.p * probs[li], n: c.n})
+				}
+			}
+			if li++; li == len(lengths) {
+				break
+			}
+		}
+		next := make([][]pclass, runes+1)
+		for prev, pp := range prefixes {
+			if len(pp) == 0 {
+				continue
+			}
+			t := table(pos, prev)
+			var last uint64
+			for i, cu := range t.cumul {
+				q := float64(cu-last) / float64(t.total)
+				last = cu
+				for _, c := range pp {
+					next[t.idx[i]+1] = append(next[t.idx[i]+1], pclass{p: c.p * q, n: c.n})
+				}
+			}
+		}
+		for i := range next {
+			next[i] = mergeClasses(next[i], 64, 2)
+		}
+		prefixes = next
+	}
+	return compactClasses(classes)
+}
+
+// CompileMarkovFile is like CompileMarkov, reading the model from a file
+// saved by WriteTo.
+func (r *Rainbow) CompileMarkovFile(fName string, min, max, topN int) *Rainbow {
+	f, err := os.Open(fName)
+	if err != nil {
+		panic(err)
+	}
+	defer f.Close()
+	m, err := ReadMarkovModel(f)
+	if err != nil {
+		panic(err)
+	}
+	return r.CompileMarkov(m, min, max, topN)
+}
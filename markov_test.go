@@ -0,0 +1,97 @@
+package rainbow
+
+import (
+	"bytes"
+	"crypto"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+)
+
+func trainTestMarkov(t *testing.T, words string, perPosition bool) *MarkovModel {
+	t.Helper()
+	m, e := TrainMarkov(strings.NewReader(words), perPosition)
+	if e != nil {
+		t.Fatal(e)
+	}
+	return m
+}
+
+func TestCompileMarkov(t *testing.T) {
+	m := trainTestMarkov(t, "ab\nab\nac\n\nba\n", false)
+	r := New(crypto.MD5, 10).CompileMarkov(m, 1, 4, 0)
+
+	// strings follow the transition probabilities
+	probs := map[string]float64{"ab": 3. / 4 * 2 / 3, "ac": 3. / 4 * 1 / 3, "ba": 1. / 4}
+	checkDistribution(t, "markov", sample(r, 30_000), probs, 30_000)
+	if s := r.NamespaceSize(); s != 3 {
+		t.Fatalf("expected 3 strings, got %v", s)
+	}
+	if e := r.EffectiveNamespaceSize(); math.Abs(e-8./3) > 1e-9 {
+		t.Fatalf("expected an effective size of 8/3, got %v", e)
+	}
+
+	// only the most frequent rune is kept
+	r = New(crypto.MD5, 10).CompileMarkov(m, 1, 4, 1)
+	checkDistribution(t, "markov top 1", sample(r, 1_000), map[string]float64{"ab": 1}, 1_000)
+
+	// unseen contexts use the overall frequencies,
+	// and lengths are uniform when no training word fits
+	m = trainTestMarkov(t, "ab\n", false)
+	r = New(crypto.MD5, 10).CompileMarkov(m, 3, 4, 0)
+	// b is never followed, a is always followed by b
+	probs = map[string]float64{"aba": 1. / 4, "abb": 1. / 4, "abab": 1. / 4, "abba": 1. / 8, "abbb": 1. / 8}
+	checkDistribution(t, "markov fallback", sample(r, 30_000), probs, 30_000)
+	if s := r.NamespaceSize(); s != 5 {
+		t.Fatalf("expected 5 strings, got %v", s)
+	}
+}
+
+func TestMarkovPerPosition(t *testing.T) {
+	m := trainTestMarkov(t, "aab\n", true)
+	r := New(crypto.MD5, 10).CompileMarkov(m, 3, 3, 0)
+	checkDistribution(t, "markov per position", sample(r, 1_000), map[string]float64{"aab": 1}, 1_000)
+
+	// without positions, a or b may follow a, anything may follow b
+	m = trainTestMarkov(t, "aab\n", false)
+	r = New(crypto.MD5, 10).CompileMarkov(m, 3, 3, 0)
+	probs := map[string]float64{"aaa": 1. / 4, "aab": 1. / 4, "aba": 1. / 3, "abb": 1. / 6}
+	checkDistribution(t, "markov", sample(r, 30_000), probs, 30_000)
+	if s := r.NamespaceSize(); s != 4 {
+		t.Fatalf("expected 4 strings, got %v", s)
+	}
+}
+
+func TestMarkovModelFile(t *testing.T) {
+	m := trainTestMarkov(t, "password\nPassw0rd\nsécurité\n123456\n", true)
+	buf := new(bytes.Buffer)
+	if _, e := m.WriteTo(buf); e != nil {
+		t.Fatal(e)
+	}
+	mm, e := ReadMarkovModel(bytes.NewReader(buf.Bytes()))
+	if e != nil {
+		t.Fatal(e)
+	}
+	r1 := New(crypto.MD5, 10).CompileMarkov(m, 4, 10, 5).Build()
+	r2 := New(crypto.MD5, 10).CompileMarkov(mm, 4, 10, 5).Build()
+	if r1.signature != r2.signature {
+		t.Fatal("signatures differ after saving the model")
+	}
+	if r3 := New(crypto.MD5, 10).CompileMarkov(mm, 4, 10, 4).Build(); r3.signature == r1.signature {
+		t.Fatal("signature should depend on top")
+	}
+
+	for _, bad := range []string{
+		"",
+		"{}",
+		`{"Version":1,"Lengths":{}}`,
+		`{"Version":1,"Lengths":{"2":1},"Transitions":[{"Pos":1,"Prev":"a","Next":{"b":1}}]}`,
+		`{"Version":1,"Lengths":{"2":1},"Transitions":[{"Pos":0,"Prev":"ab","Next":{"b":1}}]}`,
+		`{"Version":1,"Lengths":{"2":1},"Transitions":[{"Pos":0,"Prev":"","Next":{"":1}}]}`,
+	} {
+		if _, e := ReadMarkovModel(strings.NewReader(bad)); !errors.Is(e, ErrCorrupted) {
+			t.Fatalf("reading %q, expected ErrCorrupted, got %v", bad, e)
+		}
+	}
+}
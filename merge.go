@@ -0,0 +1,197 @@
+package rainbow
+
+import (
+	"bytes"
+	"container/heap"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// mergeHeap is a heap of tableReaders, ordered by current record.
+type mergeHeap []*tableReader
+
+func (h mergeHeap) Len() int { return len(h) }
+func (h mergeHeap) Less(i, j int) bool {
+	return compareRecords(h[i].rec, h[j].rec, h[i].fh.hsize) < 0
+}
+func (h mergeHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *mergeHeap) Push(x interface{}) { *h = append(*h, x.(*tableReader)) }
+func (h *mergeHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// Merge merges the sorted table files inputs into a single sorted
+// table file, output.
+// All inputs should share the same signature.
+// Merging is done on disk, with a k-way merge, so the tables do not need
+// to fit in memory. Identical chains are deduplicated.
+// If removeMerged is set, chains sharing the same end as a previous chain
+// (merged chains) are removed too, keeping only the first one.
+// Inputs may be different shards, whose ranges should be contiguous,
+// see mergeShards.
+// The output, which cannot be one of the inputs, is written to a temporary
+// file in the same directory, renamed on success, and removed on error.
+func Merge(output string, removeMerged bool, inputs ...string) error {
+	return MergeWithProgress(nil, output, removeMerged, inputs...)
+}
+
+// number of chains written between calls to the progress function
+const mergeProgressStep = 100_000
+
+// MergeWithProgress is Merge, calling progress, if not nil, every
+// 100,000 chains written and once the merge is complete, with the numbers
+// of chains written and dropped so far.
+func MergeWithProgress(progress func(merged, dropped uint64), output string, removeMerged bool, inputs ...string) (err error) {
+	if len(inputs) == 0 {
+		return errors.New("nothing to merge")
+	}
+	if so, e := os.Stat(output); e == nil {
+		for _, in := range inputs {
+			if si, e := os.Stat(in); e == nil && os.SameFile(so, si) {
+				return fmt.Errorf("cannot merge into %s, which is an input", output)
+			}
+		}
+	}
+
+	// open and check all inputs
+	h := make(mergeHeap, 0, len(inputs))
+	defer func() {
+		for _, tr := range h {
+			tr.close()
+		}
+	}()
+	var fh *fileHeader
+	for _, in := range inputs {
+		tr, e := openTableReader(in)
+		if e != nil {
+			return e
+		}
+		h = append(h, tr)
+		if fh == nil {
+			fh = tr.fh
+			continue
+		}
+		if tr.fh.signature != fh.signature || tr.fh.recsize != fh.recsize {
+			return errorf(ErrSignatureMismatch, "%s", in)
+		}
+	}
+
+	// create output, merging shard information
+	out := &fileHeader{hsize: fh.hsize, recsize: fh.recsize, signature: fh.signature,
+		shard: fh.shard, shards: fh.shards, lo: fh.lo, hi: fh.hi}
+	if err = mergeShards(out, h); err != nil {
+		return err
+	}
+	tw, tmp, err := createTempTable(output, out)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if e := tw.close(); err == nil {
+			err = e
+		}
+		if err == nil {
+			err = os.Rename(tmp, output)
+		}
+		if err != nil {
+			os.Remove(tmp)
+		}
+	}()
+
+	// k-way merge
+	var last []byte
+	var dropped uint64
+	// keep exhausted readers out of the heap
+	hh := h[:0:0]
+	for _, tr := range h {
+		if tr.rec != nil {
+			hh = append(hh, tr)
+		}
+	}
+	heap.Init(&hh)
+	for hh.Len() > 0 {
+		tr := hh[0]
+		rec := tr.rec
+		switch {
+		case last != nil && bytes.Equal(rec, last):
+			dropped++
+		case last != nil && removeMerged && bytes.Equal(rec[fh.hsize:2*fh.hsize], last[fh.hsize:2*fh.hsize]):
+			dropped++
+		default:
+			if err = tw.write(rec); err != nil {
+				return err
+			}
+			last = rec
+			if progress != nil && out.count%mergeProgressStep == 0 {
+				progress(out.count, dropped)
+			}
+		}
+		if err = tr.next(); err != nil {
+			return err
+		}
+		if tr.rec == nil {
+			heap.Pop(&hh)
+		} else {
+			heap.Fix(&hh, 0)
+		}
+	}
+
+	if progress != nil {
+		progress(out.count, dropped)
+	}
+	return nil
+}
+
+// createTempTable creates a table file with header fh, as a temporary
+// file in the directory of output, to be renamed to output once complete.
+func createTempTable(output string, fh *fileHeader) (tw *tableWriter, tmp string, err error) {
+	f, err := os.CreateTemp(filepath.Dir(output), filepath.Base(output)+".*.tmp")
+	if err != nil {
+		return nil, "", err
+	}
+	f.Chmod(0644)
+	f.Close()
+	if tw, err = createTable(f.Name(), fh); err != nil {
+		os.Remove(f.Name())
+		return nil, "", err
+	}
+	return tw, f.Name(), nil
+}
+
+// mergeShards sets the shard information of out, covering the union
+// of the ranges of the inputs h, which should be contiguous.
+// The output keeps the shard index of the lowest range, and becomes
+// shard 0 of 1 when it covers all the prefixes.
+// Empty ranges are ignored.
+func mergeShards(out *fileHeader, h mergeHeap) error {
+	var ranges []*fileHeader
+	for _, tr := range h {
+		if tr.fh.lo < tr.fh.hi {
+			ranges = append(ranges, tr.fh)
+		}
+	}
+	if len(ranges) == 0 {
+		return nil
+	}
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i].lo < ranges[j].lo })
+	first := ranges[0]
+	out.shard, out.shards, out.lo, out.hi = first.shard, first.shards, first.lo, first.hi
+	for _, fh := range ranges[1:] {
+		if fh.lo > out.hi {
+			return fmt.Errorf("cannot merge shards, prefixes %x to %x are missing", out.hi, fh.lo)
+		}
+		if fh.hi > out.hi {
+			out.hi = fh.hi
+		}
+	}
+	if out.lo == 0 && out.hi == prefixLimit {
+		out.shard, out.shards = 0, 1
+	}
+	return nil
+}
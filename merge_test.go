@@ -0,0 +1,199 @@
+package rainbow
+
+import (
+	"bytes"
+	"crypto"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMerge(t *testing.T) {
+	dir := t.TempDir()
+
+	// three overlapping partial tables, and their union
+	all := getTestRainbow(20)
+	for i := 0; i < 3_000; i++ {
+		all.AddChain(all.NewChain())
+	}
+	var inputs []string
+	for k := 0; k < 3; k++ {
+		r := getTestRainbow(20)
+		r.AddChain(all.chains[k*1_000 : (k+1)*1_000]...)
+		// overlap with the next partial table
+		r.AddChain(all.chains[((k+1)*1_000)%3_000 : ((k+1)*1_000)%3_000+100]...)
+		fname := filepath.Join(dir, "part"+string(rune('0'+k))+".rbw")
+		saveTestTable(t, r, fname)
+		inputs = append(inputs, fname)
+	}
+
+	output := filepath.Join(dir, "merged.rbw")
+	var merged, dropped uint64
+	progress := func(m, d uint64) { merged, dropped = m, d }
+	if e := MergeWithProgress(progress, output, false, inputs...); e != nil {
+		t.Fatal(e)
+	}
+	if merged != 3_000 || dropped != 300 {
+		t.Fatalf("reported %d chains merged and %d dropped", merged, dropped)
+	}
+	tb, e := getTestRainbow(20).OpenTable(output)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer tb.Close()
+	if !bytes.Equal(tb.recs, all.Freeze().recs) {
+		t.Fatal("merged table differs from the union of the chains")
+	}
+
+	// removing merged chains keeps a single chain per end
+	output2 := filepath.Join(dir, "merged2.rbw")
+	if e := Merge(output2, true, append(inputs, output)...); e != nil {
+		t.Fatal(e)
+	}
+	tb2, e := getTestRainbow(20).OpenTable(output2)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer tb2.Close()
+	ends := make(map[string]bool)
+	for _, c := range all.chains {
+		ends[string(c.end)] = true
+	}
+	if tb2.Len() != len(ends) {
+		t.Fatalf("expected %d chains with distinct ends, got %d", len(ends), tb2.Len())
+	}
+	for i := 1; i < tb2.Len(); i++ {
+		if bytes.Compare(tb2.end(i-1), tb2.end(i)) >= 0 {
+			t.Fatal("merged chains are not removed, or not sorted")
+		}
+	}
+}
+
+func TestMergeMismatch(t *testing.T) {
+	dir := t.TempDir()
+	r1 := getTestRainbow(20)
+	r1.AddChain(r1.NewChain())
+	saveTestTable(t, r1, filepath.Join(dir, "a.rbw"))
+
+	r2 := New(crypto.MD5, 20).CompileAlphabet("abc", 2, 3).Build()
+	r2.AddChain(r2.NewChain())
+	saveTestTable(t, r2, filepath.Join(dir, "b.rbw"))
+
+	if e := Merge(filepath.Join(dir, "c.rbw"), false, filepath.Join(dir, "a.rbw"), filepath.Join(dir, "b.rbw")); e == nil {
+		t.Fatal("merging tables with different signatures should fail")
+	}
+	if e := Merge(filepath.Join(dir, "c.rbw"), false); e == nil {
+		t.Fatal("merging nothing should fail")
+	}
+}
+
+func TestMergeFailures(t *testing.T) {
+	dir := t.TempDir()
+	r := getTestRainbow(20)
+	for i := 0; i < 100; i++ {
+		r.AddChain(r.NewChain())
+	}
+	a := filepath.Join(dir, "a.rbw")
+	saveTestTable(t, r, a)
+	data, _ := os.ReadFile(a)
+
+	// the output cannot be an input, whatever its path
+	if e := Merge(filepath.Join(dir, ".", "a.rbw"), false, a); e == nil {
+		t.Fatal("merging into an input should fail")
+	}
+	if got, _ := os.ReadFile(a); !bytes.Equal(got, data) {
+		t.Fatal("the input was modified")
+	}
+
+	// a truncated input leaves the previous output, and no temporary file
+	b := filepath.Join(dir, "b.rbw")
+	os.WriteFile(b, data[:len(data)-10], 0644)
+	output := filepath.Join(dir, "out.rbw")
+	os.WriteFile(output, []byte("previous"), 0644)
+	if e := Merge(output, false, a, b); !errors.Is(e, ErrTruncated) {
+		t.Fatalf("expected %v, got %v", ErrTruncated, e)
+	}
+	if got, _ := os.ReadFile(output); string(got) != "previous" {
+		t.Fatal("the output was overwritten by a failed merge")
+	}
+	if files, _ := os.ReadDir(dir); len(files) != 3 {
+		t.Fatalf("unexpected files %v", files)
+	}
+}
+
+func TestMergeShards(t *testing.T) {
+	dir := t.TempDir()
+	r := getTestRainbow(20)
+	for i := 0; i < 1_000; i++ {
+		r.AddChain(r.NewChain())
+	}
+	input := filepath.Join(dir, "full.rbw")
+	saveTestTable(t, r, input)
+	var shards []string
+	for i := 0; i < 4; i++ {
+		shards = append(shards, filepath.Join(dir, fmt.Sprintf("shard%d.rbw", i)))
+	}
+	if e := Split(input, shards...); e != nil {
+		t.Fatal(e)
+	}
+
+	// contiguous shards merge into their union
+	middle := filepath.Join(dir, "middle.rbw")
+	if e := Merge(middle, false, shards[2], shards[1]); e != nil {
+		t.Fatal(e)
+	}
+	tb, e := getTestRainbow(20).OpenTable(middle)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer tb.Close()
+	if lo, hi := tb.ShardRange(); lo != 1<<30 || hi != 3<<30 {
+		t.Fatalf("unexpected range %x - %x", lo, hi)
+	}
+	if s, n := tb.ShardIndex(); s != 1 || n != 4 {
+		t.Fatalf("unexpected shard index %d of %d", s, n)
+	}
+	first, e := getTestRainbow(20).OpenTable(shards[0])
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer first.Close()
+	if _, e := getTestRainbow(20).NewShardedTable(first, tb); e != nil {
+		t.Fatal(e)
+	}
+
+	// all the shards give back the table
+	all := filepath.Join(dir, "all.rbw")
+	if e := Merge(all, false, shards...); e != nil {
+		t.Fatal(e)
+	}
+	tb2, e := getTestRainbow(20).OpenTable(all)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer tb2.Close()
+	if s, n := tb2.ShardIndex(); s != 0 || n != 1 || !bytes.Equal(tb2.recs, r.Freeze().recs) {
+		t.Fatal("merging all the shards should give back the table")
+	}
+
+	// a missing shard is rejected
+	if e := Merge(filepath.Join(dir, "gap.rbw"), false, shards[0], shards[2]); e == nil {
+		t.Fatal("merging shards that are not contiguous should fail")
+	}
+}
+
+// ============================= utilities ==============================
+
+// save r as a table file.
+func saveTestTable(t *testing.T, r *Rainbow, fName string) {
+	f, e := os.Create(fName)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer f.Close()
+	if e = r.Save(f); e != nil {
+		t.Fatal(e)
+	}
+}
@@ -0,0 +1,25 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly)
+// +build !linux,!darwin,!freebsd,!netbsd,!openbsd,!dragonfly
+
+package rainbow
+
+import (
+	"io"
+	"os"
+)
+
+// mmapFile reads the first size bytes of f in memory,
+// since memory mapping is not available on this platform.
+func mmapFile(f *os.File, size int) ([]byte, error) {
+	data := make([]byte, size)
+	_, err := f.ReadAt(data, 0)
+	if err == io.EOF {
+		err = nil
+	}
+	return data, err
+}
+
+// munmapFile releases data obtained from mmapFile.
+func munmapFile(data []byte) error {
+	return nil
+}
@@ -0,0 +1,209 @@
+package rainbow
+
+import (
+	"math"
+	"sort"
+)
+
+// Name space estimations assume the compiled modules are independent,
+// and that distinct module outputs concatenate into distinct passwords.
+// They are upper bounds when, for instance, a word list holds words
+// that are prefixes of others.
+
+// pclass is a class of passwords sharing the same probability.
+type pclass struct {
+	// probability of each password of the class
+	p float64
+	// number of passwords in the class
+	n float64
+}
+
+// maximum number of classes kept when combining modules
+const maxClasses = 4096
+
+// compactClasses merges classes with the same probability.
+// Beyond maxClasses, classes with close probabilities are merged too,
+// keeping their total probability.
+func compactClasses(classes []pclass) []pclass {
+	return mergeClasses(classes, maxClasses, 64)
+}
+
+// mergeClasses merges classes with the same probability.
+// Beyond limit classes, classes are merged by buckets of 1/perBit
+// of a bit of log2 probability.
+func mergeClasses(classes []pclass, limit int, perBit float64) []pclass {
+	sort.Slice(classes, func(i, j int) bool { return classes[i].p < classes[j].p })
+	res := classes[:0]
+	for _, c := range classes {
+		if len(res) > 0 && res[len(res)-1].p == c.p {
+			res[len(res)-1].n += c.n
+			continue
+		}
+		res = append(res, c)
+	}
+	if len(res) <= limit {
+		return res
+	}
+
+	// merge by buckets of log2 probability
+	buckets := make(map[int]*pclass)
+	var keys []int
+	for _, c := range res {
+		k := int(math.Floor(math.Log2(c.p) * perBit))
+		b := buckets[k]
+		if b == nil {
+			b = new(pclass)
+			buckets[k] = b
+			keys = append(keys, k)
+		}
+		// p holds the total probability until normalized below
+		b.p += c.p * c.n
+		b.n += c.n
+	}
+	merged := make([]pclass, 0, len(keys))
+	for _, k := range keys {
+		b := buckets[k]
+		merged = append(merged, pclass{p: b.p / b.n, n: b.n})
+	}
+	sort.Slice(merged, func(i, j int) bool { return merged[i].p < merged[j].p })
+	return merged
+}
+
+// classes of the passwords produced by the compiled modules.
+func (r *Rainbow) classes() []pclass {
+	if len(r.rms) == 0 {
+		return nil
+	}
+	classes := []pclass{{p: 1, n: 1}}
+	for _, m := range r.rms {
+		if m.joint {
+			classes = m.classes
+			continue
+		}
+		next := make([]pclass, 0, len(classes)*len(m.classes))
+		for _, a := range classes {
+			for _, b := range m.classes {
+				next = append(next, pclass{p: a.p * b.p, n: a.n * b.n})
+			}
+		}
+		classes = compactClasses(next)
+	}
+	return classes
+}
+
+// maximum number of passwords enumerated by enumerate
+const maxEnumerated = 1 << 20
+
+// enumerate calls yield with each password of the compiled modules,
+// and its probability. It returns false, without calling yield, when
+// a module cannot enumerate its outputs, or when there are more than
+// maxEnumerated passwords.
+func (r *Rainbow) enumerate(yield func(p []byte, q float64)) bool {
+	for _, m := range r.rms {
+		if m.values == nil || m.joint {
+			return false
+		}
+	}
+	if r.NamespaceSize() > maxEnumerated {
+		return false
+	}
+	var walk func(i int, p []byte, q float64)
+	walk = func(i int, p []byte, q float64) {
+		if i == len(r.rms) {
+			yield(p, q)
+			return
+		}
+		r.rms[i].values(func(v []byte, vq float64) {
+			walk(i+1, append(p[:len(p):len(p)], v...), q*vq)
+		})
+	}
+	walk(0, nil, 1)
+	return true
+}
+
+// NamespaceSize estimates the number of distinct passwords
+// the compiled modules can produce.
+func (r *Rainbow) NamespaceSize() float64 {
+	var size float64
+	for _, c := range r.classes() {
+		size += c.n
+	}
+	return size
+}
+
+// NamespaceSampled reports whether name space estimations rely on a
+// sample of passwords, as CompileSubstitution does when the previous
+// modules cannot enumerate their passwords. Such estimations may vary
+// with the sample.
+func (r *Rainbow) NamespaceSampled() bool {
+	for _, m := range r.rms {
+		if m.sampled {
+			return true
+		}
+	}
+	return false
+}
+
+// BitLen is the approximate number of bits needed to encode
+// the compiled name space.
+func (r *Rainbow) BitLen() int {
+	if len(r.rms) == 0 {
+		return 0
+	}
+	return int(math.Ceil(math.Log2(r.NamespaceSize())))
+}
+
+// EffectiveNamespaceSize estimates the size of a uniform name space
+// that would behave like the compiled one, whose passwords may not all
+// have the same probability, because of weighted modules or of the
+// length selection of CompileAlphabet.
+// It is the inverse of the probability that two independent reductions
+// produce the same password, and never exceeds NamespaceSize.
+func (r *Rainbow) EffectiveNamespaceSize() float64 {
+	var collision float64
+	for _, c := range r.classes() {
+		collision += c.n * c.p * c.p
+	}
+	if collision == 0 {
+		return 0
+	}
+	return 1 / collision
+}
+
+// Coverage estimates the probability that a lookup succeeds,
+// with the specified number of chains, for a password drawn with the
+// same probabilities as the reduce function draws them.
+// It generalizes the classic rainbow table estimation to passwords of
+// unequal probabilities : each column of the table holds the distinct
+// passwords drawn by the chains that did not merge yet.
+// In distinguished point mode, chains are assumed to have their
+// expected length, and merges are ignored, which is optimistic.
+func (r *Rainbow) Coverage(chains int) float64 {
+	classes := r.classes()
+	if len(classes) == 0 || chains <= 0 {
+		return 0
+	}
+
+	// draws is the number of distinct chains, summed over the columns
+	var draws float64
+	if r.dp > 0 {
+		draws = float64(chains) * math.Min(math.Pow(2, float64(r.dp)), float64(r.cl))
+	} else {
+		m := float64(chains)
+		for i := 0; i < r.cl; i++ {
+			draws += m
+			// expected number of distinct passwords among m draws
+			var distinct float64
+			for _, c := range classes {
+				distinct += c.n * -math.Expm1(-c.p*m)
+			}
+			m = distinct
+		}
+	}
+
+	var found float64
+	for _, c := range classes {
+		found += c.n * c.p * -math.Expm1(-c.p*draws)
+	}
+	return found
+}
@@ -0,0 +1,107 @@
+package rainbow
+
+import (
+	"crypto"
+	"math"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestNamespaceSize(t *testing.T) {
+	upper := func(p []byte) []byte { return []byte(strings.ToUpper(string(p))) }
+	double := func(p []byte) []byte { return append(p, p...) }
+
+	r := New(crypto.MD5, 10).
+		CompileAlphabet("abc", 1, 2).
+		CompileTransform(upper, nil, nil)
+	if ns := r.NamespaceSize(); ns != 12*2 {
+		t.Fatalf("expected a name space of 24, got %v", ns)
+	}
+	if b := r.BitLen(); b != 5 {
+		t.Fatalf("expected 5 bits, got %d", b)
+	}
+	// lengths 1 and 2 are equally likely, transforms 1/3 and 2/3
+	eff := 1 / ((1./3/4 + 1./9/4) * (1./9 + 4./9))
+	if e := r.EffectiveNamespaceSize(); math.Abs(e-eff) > 1e-9 {
+		t.Fatalf("expected an effective name space of %v, got %v", eff, e)
+	}
+
+	// weights are honoured
+	w := New(crypto.MD5, 10).
+		CompileAlphabet("abc", 1, 2).
+		CompileWeightedTransform(
+			WeightedTransform{Weight: 0.9},
+			WeightedTransform{Weight: 0.05, Transform: upper},
+			WeightedTransform{Weight: 0.05, Transform: double})
+	if ns := w.NamespaceSize(); ns != 12*3 {
+		t.Fatalf("expected a name space of 36, got %v", ns)
+	}
+	if w.EffectiveNamespaceSize() >= r.EffectiveNamespaceSize() {
+		t.Fatal("skewed weights should reduce the effective name space")
+	}
+	if w.Coverage(5) <= r.Coverage(5) {
+		t.Fatal("skewed weights should improve coverage")
+	}
+}
+
+func TestCompileWeightedTransform(t *testing.T) {
+	tag := func(s string) func(p []byte) []byte {
+		return func(p []byte) []byte { return append(p, s...) }
+	}
+	r := New(crypto.MD5, 10).CompileWeightedTransform(
+		WeightedTransform{Weight: 7},
+		WeightedTransform{Weight: 2, Transform: tag("a")},
+		WeightedTransform{Weight: 1, Transform: tag("b")},
+		WeightedTransform{Weight: 0, Transform: tag("c")})
+	mod := r.rms[0]
+	if !strings.Contains(mod.signature, "[7 2 1 0]") {
+		t.Fatal("weights are not part of the signature : ", mod.signature)
+	}
+	counts := make(map[string]float64)
+	rd := rand.New(rand.NewSource(42))
+	ent := make([]byte, mod.bytes+entropySlack)
+	const n = 100_000
+	for i := 0; i < n; i++ {
+		rd.Read(ent)
+		counts[string(runModule(mod, ent, nil))]++
+	}
+	for s, p := range map[string]float64{"": 0.7, "a": 0.2, "b": 0.1, "c": 0} {
+		if math.Abs(counts[s]/n-p) > 0.01 {
+			t.Fatalf("transform %q selected with frequency %v, expected %v", s, counts[s]/n, p)
+		}
+	}
+}
+
+func TestCoverage(t *testing.T) {
+	// compare the estimation with measured success rates
+	for _, chains := range []int{100, 1_000} {
+		res := MeasureTradeoff(TradeoffConfig{
+			Alphabet: "abcdefghijklmnopqrstuvwxyz", MinLen: 2, MaxLen: 3,
+			ChainLength: 20, Chains: chains, Lookups: 500, Seed: 3,
+		})
+		r := New(crypto.MD5, 20).CompileAlphabet("abcdefghijklmnopqrstuvwxyz", 2, 3)
+		if c := r.Coverage(chains); math.Abs(c-res.SuccessRate) > 0.05 {
+			t.Fatalf("%d chains : estimated coverage %v, measured %v", chains, c, res.SuccessRate)
+		}
+	}
+}
+
+func TestEnumerate(t *testing.T) {
+	r := New(crypto.MD5, 10).CompileWordList("words_test.txt").CompileNumberRange(0, 9, 1)
+	seen := make(map[string]float64)
+	if !r.enumerate(func(p []byte, q float64) { seen[string(p)] += q }) {
+		t.Fatal("word lists and number ranges should enumerate")
+	}
+	if len(seen) != 60 || math.Abs(seen["cat7"]-1./60) > 1e-12 {
+		t.Fatalf("unexpected passwords %v", seen)
+	}
+
+	// alphabets do not enumerate, nor do large name spaces
+	if New(crypto.MD5, 10).CompileAlphabet("ab", 1, 2).enumerate(func([]byte, float64) {}) {
+		t.Fatal("alphabets should not enumerate")
+	}
+	if New(crypto.MD5, 10).CompileNumberRange(0, maxEnumerated, 0).enumerate(func([]byte, float64) {}) {
+		t.Fatal("large name spaces should not enumerate")
+	}
+}
@@ -0,0 +1,362 @@
+package rainbow
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// A probabilistic context free grammar describes passwords as a
+// structure, a sequence of segments of letters (L), digits (D) and
+// symbols (S) with their lengths, such as "L5 D2 S1" for "Hello12!".
+// Training counts the structures of a password corpus, and for each
+// segment kind and length, the terminals : lowercased letter words,
+// digit strings and symbol strings. The capitalization of letter
+// segments is counted separately, as masks of U and L, under the M kind.
+// Upper case runes that lower casing then upper casing would not restore,
+// such as 'İ' or 'ǅ', are kept as is in terminals, with an L mask.
+// Passwords are then drawn by choosing a structure, then filling each
+// segment independently, as in the Weir et al. PCFG.
+
+// version of the grammar file format
+const pcfgVersion = 1
+
+// PCFGModel holds the structure and terminal counts learnt from
+// a password corpus.
+type PCFGModel struct {
+	// structure counts, by structure, such as "L5 D2 S1"
+	structures map[string]uint64
+	// terminal counts, by segment, such as "L5", then by terminal
+	terminals map[string]map[string]uint64
+}
+
+// pcfgKind returns the segment kind of rune c.
+func pcfgKind(c rune) byte {
+	switch {
+	case unicode.IsLetter(c):
+		return 'L'
+	case c >= '0' && c <= '9':
+		return 'D'
+	}
+	return 'S'
+}
+
+// TrainPCFG learns a grammar from a password corpus, one password
+// per line. Empty lines are ignored.
+func TrainPCFG(reader io.Reader) (*PCFGModel, error) {
+	m := &PCFGModel{
+		structures: make(map[string]uint64),
+		terminals:  make(map[string]map[string]uint64),
+	}
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		psswd := strings.TrimRight(scanner.Text(), "\r")
+		if psswd == "" {
+			continue
+		}
+		var structure []string
+		rs := []rune(psswd)
+		for i := 0; i < len(rs); {
+			kind := pcfgKind(rs[i])
+			j := i + 1
+			for j < len(rs) && pcfgKind(rs[j]) == kind {
+				j++
+			}
+			seg := string(kind) + strconv.Itoa(j-i)
+			structure = append(structure, seg)
+			if kind == 'L' {
+				// runes that upper casing cannot restore, such as
+				// 'İ' lowered to 'i', are kept as is
+				mask := make([]byte, j-i)
+				lower := make([]rune, j-i)
+				for k, c := range rs[i:j] {
+					mask[k], lower[k] = 'L', c
+					if l := unicode.ToLower(c); l != c && unicode.ToUpper(l) == c {
+						mask[k], lower[k] = 'U', l
+					}
+				}
+				m.add("M"+seg[1:], string(mask), 1)
+				m.add(seg, string(lower), 1)
+			} else {
+				m.add(seg, string(rs[i:j]), 1)
+			}
+			i = j
+		}
+		m.structures[strings.Join(structure, " ")]++
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(m.structures) == 0 {
+		return nil, fmt.Errorf("no passwords to train the grammar")
+	}
+	return m, nil
+}
+
+// add adds n to the count of terminal t of segment seg.
+func (m *PCFGModel) add(seg, t string, n uint64) {
+	ts := m.terminals[seg]
+	if ts == nil {
+		ts = make(map[string]uint64)
+		m.terminals[seg] = ts
+	}
+	ts[t] += n
+}
+
+// pcfgFile is the serialized form of a PCFGModel.
+type pcfgFile struct {
+	Version    int
+	Structures map[string]uint64
+	Terminals  map[string]map[string]uint64
+}
+
+// WriteTo saves the grammar to w, as JSON.
+func (m *PCFGModel) WriteTo(w io.Writer) (int64, error) {
+	data, err := json.MarshalIndent(pcfgFile{Version: pcfgVersion, Structures: m.structures, Terminals: m.terminals}, "", " ")
+	if err != nil {
+		return 0, err
+	}
+	n, err := w.Write(append(data, '\n'))
+	return int64(n), err
+}
+
+// ReadPCFGModel reads a grammar saved by WriteTo.
+// Errors wrap ErrCorrupted when the grammar is invalid.
+func ReadPCFGModel(reader io.Reader) (*PCFGModel, error) {
+	var pf pcfgFile
+	if err := json.NewDecoder(reader).Decode(&pf); err != nil {
+		return nil, errorf(ErrCorrupted, "cannot decode grammar : %v", err)
+	}
+	if pf.Version != pcfgVersion {
+		return nil, errorf(ErrCorrupted, "unsupported grammar version %d", pf.Version)
+	}
+	m := &PCFGModel{
+		structures: make(map[string]uint64),
+		terminals:  make(map[string]map[string]uint64),
+	}
+	for seg, ts := range pf.Terminals {
+		kind, n, ok := pcfgSegment(seg, "LDSM")
+		if !ok {
+			return nil, errorf(ErrCorrupted, "invalid segment %q", seg)
+		}
+		for t, c := range ts {
+			if !pcfgTerminal(kind, n, t) {
+				return nil, errorf(ErrCorrupted, "invalid terminal %q for segment %s", t, seg)
+			}
+			if c > 0 {
+				m.add(seg, t, c)
+			}
+		}
+	}
+	for s, c := range pf.Structures {
+		if c == 0 {
+			continue
+		}
+		for _, seg := range strings.Fields(s) {
+			if _, _, ok := pcfgSegment(seg, "LDS"); !ok || len(m.terminals[seg]) == 0 {
+				return nil, errorf(ErrCorrupted, "invalid segment %q in structure %q", seg, s)
+			}
+			if seg[0] == 'L' && len(m.terminals["M"+seg[1:]]) == 0 {
+				return nil, errorf(ErrCorrupted, "no capitalization for segment %q", seg)
+			}
+		}
+		m.structures[s] = c
+	}
+	if len(m.structures) == 0 {
+		return nil, errorf(ErrCorrupted, "no structures in grammar")
+	}
+	return m, nil
+}
+
+// pcfgSegment parses a segment, such as "L5", whose kind is one of kinds.
+func pcfgSegment(seg string, kinds string) (kind byte, n int, ok bool) {
+	if len(seg) < 2 || strings.IndexByte(kinds, seg[0]) < 0 {
+		return 0, 0, false
+	}
+	n, err := strconv.Atoi(seg[1:])
+	return seg[0], n, err == nil && n > 0
+}
+
+// pcfgTerminal checks terminal t fits a segment of n runes of kind,
+// M being the kind of capitalization masks.
+func pcfgTerminal(kind byte, n int, t string) bool {
+	if !utf8.ValidString(t) || utf8.RuneCountInString(t) != n {
+		return false
+	}
+	for _, c := range t {
+		switch {
+		case kind == 'M':
+			if c != 'U' && c != 'L' {
+				return false
+			}
+		case pcfgKind(c) != kind:
+			return false
+		}
+	}
+	return true
+}
+
+// pcfgTable selects a value, with a probability proportional to its count.
+type pcfgTable struct {
+	// values, most frequent first
+	values [][]byte
+	// cumulated counts, and their total
+	cumul []uint64
+	total uint64
+}
+
+// newPCFGTable builds the table for counts.
+func newPCFGTable(counts map[string]uint64) *pcfgTable {
+	var values []string
+	for v := range counts {
+		values = append(values, v)
+	}
+	sort.Slice(values, func(i, j int) bool {
+		a, b := counts[values[i]], counts[values[j]]
+		return a > b || (a == b && values[i] < values[j])
+	})
+	t := new(pcfgTable)
+	for _, v := range values {
+		t.total += counts[v]
+		t.values = append(t.values, []byte(v))
+		t.cumul = append(t.cumul, t.total)
+	}
+	return t
+}
+
+// choose selects a value from d.
+func (t *pcfgTable) choose(d *drawer) []byte {
+	v := d.draw(t.total)
+	return t.values[sort.Search(len(t.cumul)-1, func(i int) bool { return v < t.cumul[i] })]
+}
+
+// classes of the values of the table, merged coarsely.
+func (t *pcfgTable) classes() []pclass {
+	var classes []pclass
+	var last uint64
+	for _, c := range t.cumul {
+		classes = append(classes, pclass{p: float64(c-last) / float64(t.total), n: 1})
+		last = c
+	}
+	return mergeClasses(classes, 64, 2)
+}
+
+// pcfgFill fills a segment of a structure.
+type pcfgFill struct {
+	// terminals, and capitalization masks for letters
+	terminals, masks *pcfgTable
+}
+
+// CompilePCFG appends a password drawn from a grammar : a structure is
+// chosen with its probability in the training corpus, then each segment
+// is filled with a terminal, and letters are capitalized with a mask,
+// each with its own probability. Tables thus cover the most probable
+// human passwords first.
+func (r *Rainbow) CompilePCFG(m *PCFGModel) *Rainbow {
+	if m == nil || len(m.structures) == 0 {
+		panic("invalid input parameters")
+	}
+
+	tables := make(map[string]*pcfgTable, len(m.terminals))
+	for seg, ts := range m.terminals {
+		tables[seg] = newPCFGTable(ts)
+	}
+	structures := newPCFGTable(m.structures)
+
+	// segments of each structure, in the order of the structure table,
+	// the entropy needed by the most demanding structure,
+	// and the classes of the passwords
+	fills := make([][]pcfgFill, len(structures.values))
+	var bits float64
+	var classes []pclass
+	var last uint64
+	for i, s := range structures.values {
+		var b float64
+		sc := []pclass{{p: float64(structures.cumul[i]-last) / float64(structures.total), n: 1}}
+		last = structures.cumul[i]
+		for _, seg := range strings.Fields(string(s)) {
+			f := pcfgFill{terminals: tables[seg]}
+			if seg[0] == 'L' {
+				f.masks = tables["M"+seg[1:]]
+			}
+			for _, t := range []*pcfgTable{f.terminals, f.masks} {
+				if t == nil {
+					continue
+				}
+				b += math.Log2(float64(t.total))
+				var next []pclass
+				tc := t.classes()
+				for _, a := range sc {
+					for _, c := range tc {
+						next = append(next, pclass{p: a.p * c.p, n: a.n * c.n})
+					}
+				}
+				sc = mergeClasses(next, 64, 2)
+			}
+			fills[i] = append(fills[i], f)
+		}
+		bits = math.Max(bits, b)
+		classes = append(classes, sc...)
+	}
+
+	digest := sha256.New()
+	m.WriteTo(digest)
+
+	mod := new(rmodule)
+	mod.signature = fmt.Sprintf("CompilePCFG with grammar digest %x", digest.Sum(nil)[:8])
+	mod.bytes = int(math.Ceil((math.Log2(float64(structures.total)) + bits) / 8))
+	mod.classes = compactClasses(classes)
+	mod.run = func(d *drawer, p []byte) []byte {
+		// decide on the structure
+		v := d.draw(structures.total)
+		i := sort.Search(len(structures.cumul)-1, func(i int) bool { return v < structures.cumul[i] })
+
+		// fill its segments
+		for _, f := range fills[i] {
+			t := f.terminals.choose(d)
+			if f.masks == nil {
+				p = append(p, t...)
+				continue
+			}
+			mask := f.masks.choose(d)
+			k := 0
+			for _, c := range string(t) {
+				if mask[k] == 'U' {
+					c = unicode.ToUpper(c)
+				}
+				p = utf8.AppendRune(p, c)
+				k++
+			}
+		}
+		return p
+	}
+
+	// append the rmodule
+	r.rms = append(r.rms, mod)
+
+	return r
+}
+
+// CompilePCFGFile is like CompilePCFG, reading the grammar from a file
+// saved by WriteTo.
+func (r *Rainbow) CompilePCFGFile(fName string) *Rainbow {
+	f, err := os.Open(fName)
+	if err != nil {
+		panic(err)
+	}
+	defer f.Close()
+	m, err := ReadPCFGModel(f)
+	if err != nil {
+		panic(err)
+	}
+	return r.CompilePCFG(m)
+}
@@ -0,0 +1,80 @@
+package rainbow
+
+import (
+	"bytes"
+	"crypto"
+	"errors"
+	"strings"
+	"testing"
+)
+
+const pcfgCorpus = "Hello12!\nhello12!\n\nworld12!\nabc\n"
+
+func TestCompilePCFG(t *testing.T) {
+	m, e := TrainPCFG(strings.NewReader(pcfgCorpus))
+	if e != nil {
+		t.Fatal(e)
+	}
+	if m.structures["L5 D2 S1"] != 3 || m.structures["L3"] != 1 || m.terminals["M5"]["ULLLL"] != 1 {
+		t.Fatalf("unexpected grammar : %v %v", m.structures, m.terminals)
+	}
+
+	// structures, terminals and masks are drawn independently
+	r := New(crypto.MD5, 10).CompilePCFG(m)
+	probs := map[string]float64{
+		"Hello12!": 3. / 4 * 2 / 3 * 1 / 3,
+		"hello12!": 3. / 4 * 2 / 3 * 2 / 3,
+		"World12!": 3. / 4 * 1 / 3 * 1 / 3,
+		"world12!": 3. / 4 * 1 / 3 * 2 / 3,
+		"abc":      1. / 4,
+	}
+	checkDistribution(t, "pcfg", sample(r, 30_000), probs, 30_000)
+	if s := r.NamespaceSize(); s != 5 {
+		t.Fatalf("expected 5 passwords, got %v", s)
+	}
+}
+
+func TestPCFGCaseRoundTrip(t *testing.T) {
+	// 'İ' lowers to 'i', and title case 'ǅ' to 'ǆ', which upper case
+	// to 'I' and 'Ǆ' : such runes are kept as is
+	m, e := TrainPCFG(strings.NewReader("İstanbul1\nǅungla\nParis\n"))
+	if e != nil {
+		t.Fatal(e)
+	}
+	if m.terminals["L8"]["İstanbul"] != 1 || m.terminals["M8"]["LLLLLLLL"] != 1 || m.terminals["L6"]["ǅungla"] != 1 {
+		t.Fatalf("unexpected grammar : %v", m.terminals)
+	}
+	probs := map[string]float64{"İstanbul1": 1. / 3, "ǅungla": 1. / 3, "Paris": 1. / 3}
+	checkDistribution(t, "pcfg case", sample(New(crypto.MD5, 10).CompilePCFG(m), 10_000), probs, 10_000)
+}
+
+func TestPCFGModelFile(t *testing.T) {
+	m, _ := TrainPCFG(strings.NewReader(pcfgCorpus + "Ça1va\n"))
+	buf := new(bytes.Buffer)
+	if _, e := m.WriteTo(buf); e != nil {
+		t.Fatal(e)
+	}
+	mm, e := ReadPCFGModel(bytes.NewReader(buf.Bytes()))
+	if e != nil {
+		t.Fatal(e)
+	}
+	if New(crypto.MD5, 10).CompilePCFG(m).Build().signature != New(crypto.MD5, 10).CompilePCFG(mm).Build().signature {
+		t.Fatal("signatures differ after saving the grammar")
+	}
+
+	for _, bad := range []string{
+		"",
+		`{"Version":2}`,
+		`{"Version":1,"Structures":{}}`,
+		`{"Version":1,"Structures":{"D2":1}}`,
+		`{"Version":1,"Structures":{"L2":1},"Terminals":{"L2":{"ab":1}}}`,
+		`{"Version":1,"Structures":{"D2":1},"Terminals":{"D2":{"1a":1}}}`,
+		`{"Version":1,"Structures":{"D2":1},"Terminals":{"D2":{"123":1}}}`,
+		`{"Version":1,"Structures":{"L2":1},"Terminals":{"L2":{"ab":1},"M2":{"UX":1}}}`,
+		`{"Version":1,"Structures":{"X2":1},"Terminals":{"X2":{"ab":1}}}`,
+	} {
+		if _, e := ReadPCFGModel(strings.NewReader(bad)); !errors.Is(e, ErrCorrupted) {
+			t.Fatalf("reading %q, expected ErrCorrupted, got %v", bad, e)
+		}
+	}
+}
@@ -11,7 +11,7 @@ import (
 
 // Version of the package
 func Version() (major, minor, sub int) {
-	return 0, 6, 3
+	return 0, 7, 24
 }
 
 // VersionString for human consumption
@@ -37,11 +37,20 @@ type Rainbow struct {
 	// number of bytes of entropy consumed by the reduce function
 	used int
 
-	// cl is the chain length (constant)
+	// cl is the chain length (constant),
+	// or the maximum chain length in distinguished point mode
 	cl int
+	// number of leading zero bits of the distinguished points,
+	// 0 for fixed length chains
+	dp int
 
 	// Random generator
 	rand *rand.Rand
+	// seed of the chain starts, drawn from rand on first use
+	seed   uint64
+	seeded bool
+	// index of the next chain start
+	next uint64
 	// chains
 	chains []*Chain
 	// Are the chains sorted ?
@@ -70,6 +79,21 @@ func New(hashAlgo crypto.Hash, chainLength int) *Rainbow {
 	return r
 }
 
+// NewDistinguished constructs a new, empty rainbow table, using
+// distinguished point chains instead of fixed length chains.
+// A chain ends as soon as its hash starts with bits zero bits,
+// and is discarded if it loops or exceeds maxLength.
+// The same reduce function is used at every step, so a lookup walks
+// the hash forward only once, instead of once per depth.
+func NewDistinguished(hashAlgo crypto.Hash, bits, maxLength int) *Rainbow {
+	if bits <= 0 || bits > 8*hashAlgo.Size() || maxLength <= 0 {
+		panic("invalid distinguished point parameters")
+	}
+	r := New(hashAlgo, maxLength)
+	r.dp = bits
+	return r
+}
+
 // ReduceFunction is a function that reduces a hash
 // into a password, the next in the chain.
 // The password value is returned as a byte slice.
@@ -88,6 +112,8 @@ type HashFunction func(passwd []byte, hash []byte) []byte
 type Chain struct {
 	start []byte
 	end   []byte
+	// number of steps from start to end
+	length int
 }
 
 // Equal compare chains
@@ -99,13 +125,45 @@ func (c *Chain) Equal(cc *Chain) bool {
 		bytes.Compare(c.end, cc.end) == 0
 }
 
-// NewChain builds a new Chain, from random start.
+// NewChain builds a new Chain, from a new start.
+// Starts are derived from a random seed and the index of the chain,
+// so that they can be stored compactly, see WriteCompressed.
 // It is not immediateley added to the Chains slice in r.
 // See - AddChain below.
 func (r *Rainbow) NewChain() *Chain {
+	if !r.seeded {
+		r.seed, r.seeded = r.rand.Uint64(), true
+	}
+	c, next := r.newChain(r.seed, r.next)
+	r.next = next
+	return c
+}
+
+// newChain builds the Chain of the given index, deriving its start from
+// seed, and returns the index of the next chain. In distinguished point
+// mode, a discarded chain uses up its index, and the next one is tried.
+func (r *Rainbow) newChain(seed, index uint64) (*Chain, uint64) {
+	if r.dp == 0 {
+		return r.chainFrom(seededStart(seed, index, r.hsize)), index + 1
+	}
+	for i := 0; i < maxDPAttempts; i++ {
+		if c, _ := r.dpChainFrom(seededStart(seed, index, r.hsize)); c != nil {
+			return c, index + 1
+		}
+		index++
+	}
+	panic("cannot reach distinguished points, check the number of bits and the maximum length")
+}
+
+// maximum number of consecutive discarded chains in distinguished point mode
+const maxDPAttempts = 1 << 16
+
+// chainFrom builds the Chain starting from the provided start.
+// start is used as is, and should not be modified afterwards.
+func (r *Rainbow) chainFrom(start []byte) *Chain {
 	c := new(Chain)
-	c.start = make([]byte, r.hsize, r.hsize)
-	r.rand.Read(c.start)
+	c.start = start
+	c.length = r.cl
 	c.end = append([]byte{}, c.start...)
 	p := []byte{}
 	for i := 0; i < r.cl; i++ {
@@ -116,6 +174,41 @@ func (r *Rainbow) NewChain() *Chain {
 	return c
 }
 
+// dpChainFrom builds the distinguished point Chain starting from start.
+// It returns nil if no distinguished point is reached within the maximum
+// length, and reports if it stopped early because the chain loops.
+// Loops are detected with Brent's algorithm.
+func (r *Rainbow) dpChainFrom(start []byte) (c *Chain, loop bool) {
+	buf := append([]byte{}, start...)
+	saved := append([]byte{}, start...)
+	p := []byte{}
+	for i := 1; i <= r.cl; i++ {
+		p = r.rf(0, buf, p)
+		buf = r.hf(p, buf)
+		if distinguished(buf, r.dp) {
+			return &Chain{start: start, end: buf, length: i}, false
+		}
+		if bytes.Equal(buf, saved) {
+			return nil, true
+		}
+		if i&(i-1) == 0 {
+			saved = append(saved[:0], buf...)
+		}
+	}
+	return nil, false
+}
+
+// distinguished checks if h starts with bits zero bits.
+func distinguished(h []byte, bits int) bool {
+	for ; bits >= 8; bits -= 8 {
+		if h[0] != 0 {
+			return false
+		}
+		h = h[1:]
+	}
+	return bits == 0 || h[0]>>(8-bits) == 0
+}
+
 // Build finish compiling the Rainbow table "reduce" function.
 func (r *Rainbow) Build() *Rainbow {
 
@@ -166,6 +259,11 @@ func (r *Rainbow) String() string {
 // if it exists. Found indicates if found.
 func (r *Rainbow) Lookup(h []byte) (p []byte, found bool) {
 
+	if r.dp > 0 {
+		w := r.walker()
+		return w.lookup(h, r.findStarts)
+	}
+
 	var buf []byte
 	for depth := 0; depth < r.cl; depth++ {
 		buf = append(buf[0:0], h...)
@@ -211,6 +309,19 @@ func (r *Rainbow) walkChain(c *Chain, h []byte) (p []byte, found bool) {
 	return nil, false
 }
 
+// findStarts returns the starts of the chains ending with end.
+func (r *Rainbow) findStarts(end []byte) [][]byte {
+	from, to, found := r.findChain(end)
+	if !found {
+		return nil
+	}
+	var starts [][]byte
+	for i := from; i < to; i++ {
+		starts = append(starts, r.chains[i].start)
+	}
+	return starts
+}
+
 // findChain look for the chains given its ending.
 // return the index of the matching chain, from (included) to (excluded)
 func (r *Rainbow) findChain(endHash []byte) (from, to int, found bool) {
@@ -168,6 +168,23 @@ func (r *Rainbow) getPHSample(c *Chain, level int) (p, h []byte) {
 
 }
 
+// checkLookups adds 200 chains to the built r, and checks that hashes
+// taken at level in the first 20 chains are found.
+func checkLookups(t *testing.T, r *Rainbow, level int) {
+	t.Helper()
+	r.rand = rand.New(rand.NewSource(42))
+	for i := 0; i < 200; i++ {
+		r.AddChain(r.NewChain())
+	}
+	for _, c := range r.chains[:20] {
+		psswd, h := r.getPHSample(c, level)
+		p, found := r.Lookup(h)
+		if !found || !bytes.Equal(r.hf(p, []byte{}), h) {
+			t.Fatalf("lookup failed for %q", psswd)
+		}
+	}
+}
+
 func TestDedup1(t *testing.T) {
 
 	// create a rainbow table
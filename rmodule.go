@@ -1,23 +1,39 @@
 package rainbow
 
 import (
-	"bufio"
+	"encoding/binary"
 	"fmt"
-	"os"
+	"hash"
+	"math"
+	"sync"
 )
 
 // a rmodule define the intermediate step for the reduce function.
 type rmodule struct {
-	// a rmodule is provided a subslice from the hash and the previous
-	// rmodules. It will use it to make its decisions,
-	// thus modifying the password p byte array.
+	// a rmodule is provided a drawer, holding the entropy of the hash
+	// shared by all the rmodules of a reduce step. It will use it to
+	// make its decisions, thus modifying the password p byte array.
 	// It will try not to allocate,
 	// and therefore potentially modifying passed content.
-	run func(entropy, p []byte) (pp []byte)
-	// number of bytes of entropy expected by this module
+	run func(d *drawer, p []byte) (pp []byte)
+	// number of bytes of entropy drawn by this module,
+	// not counting entropySlack
 	bytes int
 	// signature of the rmodule
 	signature string
+	// distinct outputs of the module, grouped by probability,
+	// see NamespaceSize
+	classes []pclass
+	// joint is set when classes describe the passwords produced by
+	// this module and the previous ones together, rather than
+	// the outputs of this module alone
+	joint bool
+	// sampled is set when classes are estimated from a sample
+	// of passwords, see NamespaceSampled
+	sampled bool
+	// values, when not nil, enumerates the distinct outputs
+	// of the module, with their probabilities. v should not be retained.
+	values func(yield func(v []byte, q float64))
 }
 
 // buildReduce builds a new ReduceFunction from the RMBuilder.
@@ -32,7 +48,11 @@ func (r *Rainbow) buildReduce() ReduceFunction {
 
 	r.signature = fmt.Sprintf("go-rainbow %s\nchain length %d\nhash algorithm %d\n",
 		VersionString(), r.cl, r.halgo)
-	r.used = 0
+	if r.dp > 0 {
+		r.signature += fmt.Sprintf("distinguished point bits %d\n", r.dp)
+	}
+	// the slack is shared by all the modules
+	r.used = entropySlack
 	for _, m := range r.rms {
 		r.used += m.bytes
 		r.signature += m.signature + "\n"
@@ -41,50 +61,55 @@ func (r *Rainbow) buildReduce() ReduceFunction {
 	r.built = true
 	r.signature += fmt.Sprintf("used bytes %d\n", r.used)
 
-	return func(step int, h, p []byte) []byte {
+	// hashers stretching the hash, and drawers, which would otherwise
+	// escape to the heap, the reduce function being shared
+	// by concurrent lookups
+	hashers := sync.Pool{New: func() interface{} { return r.halgo.New() }}
+	drawers := sync.Pool{New: func() interface{} { return new(drawer) }}
 
-		// autoextend hash size
-		for r.used > len(h) {
-			h = append(h, h...)
-		}
+	return func(step int, h, p []byte) []byte {
 
 		// merge the step into the hash
 		for i := range h {
 			h[i] = byte(int(h[i]) + step*(i+1))
 		}
 
+		// stretch the hash into fresh bytes, if modules need more
+		if r.used > len(h) {
+			hh := hashers.Get().(hash.Hash)
+			h = stretch(hh, h, r.used)
+			hashers.Put(hh)
+		}
+
 		// reset password, keeping capacity
 		p = p[:0]
-		// byte index
-		bi := 0
 
-		// apply the various rmodule
+		// apply the various rmodule, drawing from the same entropy
+		d := drawers.Get().(*drawer)
+		d.init(h[:r.used])
 		for _, m := range r.rms {
-
-			// extract needed entropy from current pointer
-			ent := extractEntropy(h, bi, bi+m.bytes)
-
-			// apply module
-			p = m.run(ent, p)
-
-			//fmt.Printf("Entropy before module %d= %d->%s\n", i, ent, string(p))
-
-			// refresh bit index
-			bi += m.bytes
+			p = m.run(d, p)
 		}
+		drawers.Put(d)
 		// return the last password generated
 		return p
 	}
 }
 
-// extract 'nb' bytes starting at the 'from' position,
-// returning the corresponding uint64
-func extractEntropy(h []byte, from, nb int) []byte {
-	if from+nb > len(h) {
-		// should not happen (auto extension of h)
-		panic("attempting to extract beyond h length")
-	}
-	return h[from : from+nb]
+// stretch appends to h the blocks hash(h, counter), for a counter
+// of 1, 2 ..., as a big endian uint32, until h holds at least n bytes.
+// Unlike copies of h, the blocks are independent of each other.
+func stretch(hh hash.Hash, h []byte, n int) []byte {
+	size := len(h)
+	var counter [4]byte
+	for c := uint32(1); len(h) < n; c++ {
+		binary.BigEndian.PutUint32(counter[:], c)
+		hh.Reset()
+		hh.Write(h[:size])
+		hh.Write(counter[:])
+		h = hh.Sum(h)
+	}
+	return h
 }
 
 // CompileAlphabet will compile an alpbabet of runes (a string).
@@ -96,35 +121,24 @@ func (r *Rainbow) CompileAlphabet(alphabet string, min, max int) *Rainbow {
 		panic("invalid input parameters")
 	}
 
-	// preprocess alphabet
-	alp := make([][]byte, 0, len(alphabet))
-	for _, r := range alphabet {
-		// ranging rune by rune ...
-		alp = append(alp, []byte(string(r)))
-	}
-
-	if len(alp) >= 255 {
-		panic("alphabet should not exceed 256 signs")
-	}
+	alp := alphabetSigns(alphabet)
 
 	// create rmodule
 	mod := new(rmodule)
 	mod.signature = fmt.Sprintf("CompileAlphabet with alphabet : %v, min:%d, max%d\n", alphabet, min, max)
-	mod.bytes = (max + 1) // 1 for the size and one per letter
-	mod.run = func(ent, p []byte) []byte {
-		var s, v int
-
+	// one choice for the size, and one per letter
+	mod.bytes = entropyBytes(float64(max-min+1) * math.Pow(float64(len(alp)), float64(max)))
+	for l := min; l <= max; l++ {
+		n := math.Pow(float64(len(alp)), float64(l))
+		mod.classes = append(mod.classes, pclass{p: 1 / n / float64(max-min+1), n: n})
+	}
+	mod.run = func(d *drawer, p []byte) []byte {
 		// decide on the size, s
-		if max > min {
-			s = min + int(ent[0])%(max-min+1)
-		} else {
-			s = min
-		}
+		s := min + int(d.draw(uint64(max-min+1)))
 
 		// append values to p
 		for i := 0; i < s; i++ {
-			v = int(ent[i+1]) % len(alp)
-			p = append(p, alp[v]...)
+			p = append(p, alp[d.draw(uint64(len(alp)))]...)
 		}
 		return p
 	}
@@ -135,6 +149,20 @@ func (r *Rainbow) CompileAlphabet(alphabet string, min, max int) *Rainbow {
 	return r
 }
 
+// alphabetSigns splits the alphabet into its runes.
+func alphabetSigns(alphabet string) [][]byte {
+	alp := make([][]byte, 0, len(alphabet))
+	for _, r := range alphabet {
+		// ranging rune by rune ...
+		alp = append(alp, []byte(string(r)))
+	}
+
+	if len(alp) >= 255 {
+		panic("alphabet should not exceed 256 signs")
+	}
+	return alp
+}
+
 // CompileTransform compile the password transfarmation, selecting one among all transformation.
 // One or more alternative can be nil.
 func (r *Rainbow) CompileTransform(trf ...func(p []byte) []byte) *Rainbow {
@@ -150,10 +178,11 @@ func (r *Rainbow) CompileTransform(trf ...func(p []byte) []byte) *Rainbow {
 	mod := new(rmodule)
 	mod.signature = fmt.Sprintf("CompileTransform with %d transformations", len(trf))
 
-	mod.bytes = 1
-	mod.run = func(ent, p []byte) []byte {
+	mod.bytes = entropyBytes(float64(len(trf)))
+	mod.classes = transformClasses(trf, nil)
+	mod.run = func(d *drawer, p []byte) []byte {
 		// decide on transformation to use
-		v := int(ent[0]) % len(trf)
+		v := d.draw(uint64(len(trf)))
 
 		// transform if selection is not nil
 		if trf[v] != nil {
@@ -169,59 +198,3 @@ func (r *Rainbow) CompileTransform(trf ...func(p []byte) []byte) *Rainbow {
 	return r
 
 }
-
-// CompileWordList will load the word list from file,
-// store it in memory, and select one on every reduce operation,
-// that will be appended to the current password.
-// The words are listed in the provided file, space separated,
-// as per the ScanWords SplitFunction.
-func (r *Rainbow) CompileWordList(fName string) *Rainbow {
-
-	// Open file
-	f, err := os.Open(fName)
-	if err != nil {
-		panic(err)
-	}
-	defer f.Close()
-
-	// scan and store words in memory
-	var words [][]byte
-	scanner := bufio.NewScanner(f)
-	scanner.Split(bufio.ScanWords)
-	for scanner.Scan() {
-		words = append(words, scanner.Bytes())
-	}
-
-	mod := new(rmodule)
-	mod.signature = fmt.Sprintf("CompileWordList with %d words", len(words))
-	sz := 1
-	mod.bytes = 1
-	for {
-		mod.bytes++
-		sz *= 256
-		if sz > len(words) {
-			break
-		}
-	}
-
-	mod.run = func(ent, p []byte) []byte {
-
-		// Select the word
-		var v uint64
-		for _, e := range ent {
-			v = 256*v + uint64(e)
-		}
-		v = v % uint64(len(words))
-
-		// append selected word
-		p = append(p, words[v]...)
-
-		// return
-		return p
-	}
-
-	// append the module
-	r.rms = append(r.rms, mod)
-
-	return r
-}
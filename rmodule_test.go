@@ -106,14 +106,16 @@ func TestVisualCompileTransform(t *testing.T) {
 		CompileTransform(trf, nil, nil).
 		Build()
 
-	n := 1000
+	n := 100_000
 	h := make([]byte, 16)
-	rand.Read(h)
+	rd := rand.New(rand.NewSource(42))
 
 	capi := 0
 
 	fmt.Println("List of words, 1/3rd of them capitalized ")
 	for i := 0; i < n; i++ {
+		// reduce is applied to hashes, use random values
+		rd.Read(h)
 		p := r.rf(i, h, []byte{})
 		if p[0] == byte('*') {
 			capi++
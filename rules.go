@@ -0,0 +1,555 @@
+package rainbow
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Mangling rules follow the hashcat syntax, which John the Ripper also
+// understands for its core functions. A rule is a sequence of functions,
+// applied in turn to the password, such as "c $1 $2" to capitalize
+// the password and append "12". Positions are written 0-9 then A-Z,
+// for 10 to 35. Functions operate on bytes, and case functions only
+// change ASCII letters.
+//
+// Supported functions :
+//
+//	:      do nothing
+//	l u    lowercase, uppercase
+//	c C    capitalize, invert capitalize
+//	t TN   toggle case of all, or of position N
+//	E eX   title case, after spaces or after X
+//	r      reverse
+//	d pN   duplicate, append N more copies
+//	f      reflect, append the reversed password
+//	{ }    rotate left, right
+//	$X ^X  append, prepend X
+//	[ ]    delete first, last
+//	DN     delete position N
+//	xNM    extract M characters from position N
+//	ONM    omit M characters from position N
+//	iNX    insert X at position N
+//	oNX    overwrite position N with X
+//	'N     truncate at position N
+//	sXY    substitute X with Y
+//	@X     purge all X
+//	zN ZN  duplicate first, last character N times
+//	q      duplicate every character
+//	yN YN  duplicate first, last N characters
+//	k K    swap first two, last two characters
+//	*NM    swap positions N and M
+//	LN RN  shift bits of position N left, right
+//	+N -N  increment, decrement position N
+//	.N ,N  replace position N with the next, previous character
+//
+// Rejection functions :
+//
+//	<N >N _N    reject unless the length is less than, more than, equal to N
+//	!X /X       reject if the password contains, does not contain X
+//	(X )X       reject unless the password starts, ends with X
+//	=NX         reject unless position N is X
+//	%NX         reject unless X appears at least N times
+//
+// A reduce function must always produce a password, so a rejected
+// password is left unchanged, as if the rule was ":".
+// Functions referring to a position out of range leave the password
+// unchanged, as hashcat does. Memory functions (M, X, 4, 6, Q) and the
+// John the Ripper preprocessor are not supported.
+
+// maximum length of a password produced by a rule, as in hashcat
+const maxRuleLen = 256
+
+// ruleOp is a single rule function. It returns false to reject.
+type ruleOp func(p []byte) ([]byte, bool)
+
+// Rule is a compiled mangling rule.
+type Rule struct {
+	// source of the rule
+	text string
+	ops  []ruleOp
+}
+
+// String returns the rule source.
+func (rl *Rule) String() string {
+	return rl.text
+}
+
+// Apply applies the rule to p, returning the transformed password,
+// or p itself if the rule rejects it. p is not modified.
+func (rl *Rule) Apply(p []byte) []byte {
+	q := append(make([]byte, 0, len(p)+16), p...)
+	for _, op := range rl.ops {
+		var ok bool
+		if q, ok = op(q); !ok || len(q) > maxRuleLen {
+			return p
+		}
+	}
+	return q
+}
+
+// ParseRule compiles a rule, in hashcat syntax.
+func ParseRule(text string) (*Rule, error) {
+	rl := &Rule{text: text}
+	src := []byte(text)
+	for i := 0; i < len(src); {
+		c := src[i]
+		i++
+		if c == ' ' || c == '\t' {
+			continue
+		}
+		// arguments of the function
+		nargs, ok := ruleArity[c]
+		if !ok {
+			return nil, fmt.Errorf("rule %q : unsupported function %q", text, c)
+		}
+		if i+len(nargs) > len(src) {
+			return nil, fmt.Errorf("rule %q : missing arguments for %q", text, c)
+		}
+		args := src[i : i+len(nargs)]
+		i += len(nargs)
+		var n [2]int
+		for k, kind := range nargs {
+			if kind == 'N' {
+				if n[k] = rulePosition(args[k]); n[k] < 0 {
+					return nil, fmt.Errorf("rule %q : invalid position %q", text, args[k])
+				}
+			}
+		}
+		rl.ops = append(rl.ops, ruleFunction(c, args, n))
+	}
+	return rl, nil
+}
+
+// ruleArity gives the arguments of each function,
+// N for a position or a count, X for a character.
+var ruleArity = map[byte]string{
+	':': "", 'l': "", 'u': "", 'c': "", 'C': "", 't': "", 'T': "N",
+	'E': "", 'e': "X", 'r': "", 'd': "", 'p': "N", 'f': "",
+	'{': "", '}': "", '$': "X", '^': "X", '[': "", ']': "",
+	'D': "N", 'x': "NN", 'O': "NN", 'i': "NX", 'o': "NX", '\'': "N",
+	's': "XX", '@': "X", 'z': "N", 'Z': "N", 'q': "", 'y': "N", 'Y': "N",
+	'k': "", 'K': "", '*': "NN", 'L': "N", 'R': "N", '+': "N", '-': "N",
+	'.': "N", ',': "N",
+	'<': "N", '>': "N", '_': "N", '!': "X", '/': "X", '(': "X", ')': "X",
+	'=': "NX", '%': "NX",
+}
+
+// rulePosition decodes a position, 0-9 then A-Z, or returns -1.
+func rulePosition(c byte) int {
+	switch {
+	case c >= '0' && c <= '9':
+		return int(c - '0')
+	case c >= 'A' && c <= 'Z':
+		return int(c-'A') + 10
+	}
+	return -1
+}
+
+// ascii case helpers
+func lower(b byte) byte {
+	if b >= 'A' && b <= 'Z' {
+		return b + 'a' - 'A'
+	}
+	return b
+}
+
+func upper(b byte) byte {
+	if b >= 'a' && b <= 'z' {
+		return b - 'a' + 'A'
+	}
+	return b
+}
+
+func toggle(b byte) byte {
+	if l := lower(b); l != b {
+		return l
+	}
+	return upper(b)
+}
+
+// titleCase lowers p, then uppers its first letter,
+// and every letter following sep.
+func titleCase(p []byte, sep byte) []byte {
+	for i := range p {
+		if i == 0 || p[i-1] == sep {
+			p[i] = upper(p[i])
+		} else {
+			p[i] = lower(p[i])
+		}
+	}
+	return p
+}
+
+// ruleFunction builds the operation for function c,
+// with raw arguments args, decoded as positions in n.
+func ruleFunction(c byte, args []byte, n [2]int) ruleOp {
+	// shorthands for simple, always accepted, operations
+	ok := func(f func(p []byte) []byte) ruleOp {
+		return func(p []byte) ([]byte, bool) { return f(p), true }
+	}
+	// operation on the character at position n[0], if any
+	at := func(f func(p []byte, i int)) ruleOp {
+		return ok(func(p []byte) []byte {
+			if n[0] < len(p) {
+				f(p, n[0])
+			}
+			return p
+		})
+	}
+	var x byte
+	switch {
+	case len(args) == 1:
+		x = args[0]
+	case len(args) == 2:
+		x = args[1]
+	}
+
+	switch c {
+	case ':':
+		return ok(func(p []byte) []byte { return p })
+	case 'l':
+		return ok(func(p []byte) []byte {
+			for i := range p {
+				p[i] = lower(p[i])
+			}
+			return p
+		})
+	case 'u':
+		return ok(func(p []byte) []byte {
+			for i := range p {
+				p[i] = upper(p[i])
+			}
+			return p
+		})
+	case 'c':
+		return ok(func(p []byte) []byte {
+			for i := range p {
+				if i == 0 {
+					p[i] = upper(p[i])
+				} else {
+					p[i] = lower(p[i])
+				}
+			}
+			return p
+		})
+	case 'C':
+		return ok(func(p []byte) []byte {
+			for i := range p {
+				if i == 0 {
+					p[i] = lower(p[i])
+				} else {
+					p[i] = upper(p[i])
+				}
+			}
+			return p
+		})
+	case 't':
+		return ok(func(p []byte) []byte {
+			for i := range p {
+				p[i] = toggle(p[i])
+			}
+			return p
+		})
+	case 'T':
+		return at(func(p []byte, i int) { p[i] = toggle(p[i]) })
+	case 'E':
+		return ok(func(p []byte) []byte { return titleCase(p, ' ') })
+	case 'e':
+		return ok(func(p []byte) []byte { return titleCase(p, x) })
+	case 'r':
+		return ok(func(p []byte) []byte {
+			for i, j := 0, len(p)-1; i < j; i, j = i+1, j-1 {
+				p[i], p[j] = p[j], p[i]
+			}
+			return p
+		})
+	case 'd':
+		return ok(func(p []byte) []byte { return append(p, p...) })
+	case 'p':
+		return ok(func(p []byte) []byte {
+			w := append([]byte{}, p...)
+			for k := 0; k < n[0] && len(p) <= maxRuleLen; k++ {
+				p = append(p, w...)
+			}
+			return p
+		})
+	case 'f':
+		return ok(func(p []byte) []byte {
+			for i := len(p) - 1; i >= 0; i-- {
+				p = append(p, p[i])
+			}
+			return p
+		})
+	case '{':
+		return ok(func(p []byte) []byte {
+			if len(p) > 0 {
+				p = append(p[1:], p[0])
+			}
+			return p
+		})
+	case '}':
+		return ok(func(p []byte) []byte {
+			if len(p) > 0 {
+				p = append([]byte{p[len(p)-1]}, p[:len(p)-1]...)
+			}
+			return p
+		})
+	case '$':
+		return ok(func(p []byte) []byte { return append(p, x) })
+	case '^':
+		return ok(func(p []byte) []byte { return append([]byte{x}, p...) })
+	case '[':
+		return ok(func(p []byte) []byte {
+			if len(p) > 0 {
+				p = p[1:]
+			}
+			return p
+		})
+	case ']':
+		return ok(func(p []byte) []byte {
+			if len(p) > 0 {
+				p = p[:len(p)-1]
+			}
+			return p
+		})
+	case 'D':
+		return ok(func(p []byte) []byte {
+			if n[0] < len(p) {
+				p = append(p[:n[0]], p[n[0]+1:]...)
+			}
+			return p
+		})
+	case 'x':
+		return ok(func(p []byte) []byte {
+			if n[0] < len(p) && n[0]+n[1] <= len(p) {
+				p = p[n[0] : n[0]+n[1]]
+			}
+			return p
+		})
+	case 'O':
+		return ok(func(p []byte) []byte {
+			if n[0] < len(p) && n[0]+n[1] <= len(p) {
+				p = append(p[:n[0]], p[n[0]+n[1]:]...)
+			}
+			return p
+		})
+	case 'i':
+		return ok(func(p []byte) []byte {
+			if n[0] <= len(p) {
+				p = append(p[:n[0]], append([]byte{x}, p[n[0]:]...)...)
+			}
+			return p
+		})
+	case 'o':
+		return at(func(p []byte, i int) { p[i] = x })
+	case '\'':
+		return ok(func(p []byte) []byte {
+			if n[0] < len(p) {
+				p = p[:n[0]]
+			}
+			return p
+		})
+	case 's':
+		from := args[0]
+		return ok(func(p []byte) []byte {
+			for i := range p {
+				if p[i] == from {
+					p[i] = x
+				}
+			}
+			return p
+		})
+	case '@':
+		return ok(func(p []byte) []byte {
+			q := p[:0]
+			for _, b := range p {
+				if b != x {
+					q = append(q, b)
+				}
+			}
+			return q
+		})
+	case 'z':
+		return ok(func(p []byte) []byte {
+			if len(p) > 0 {
+				p = append(bytes.Repeat(p[:1], n[0]), p...)
+			}
+			return p
+		})
+	case 'Z':
+		return ok(func(p []byte) []byte {
+			if len(p) > 0 {
+				p = append(p, bytes.Repeat(p[len(p)-1:], n[0])...)
+			}
+			return p
+		})
+	case 'q':
+		return ok(func(p []byte) []byte {
+			q := make([]byte, 0, 2*len(p))
+			for _, b := range p {
+				q = append(q, b, b)
+			}
+			return q
+		})
+	case 'y':
+		return ok(func(p []byte) []byte {
+			if n[0] <= len(p) {
+				p = append(append([]byte{}, p[:n[0]]...), p...)
+			}
+			return p
+		})
+	case 'Y':
+		return ok(func(p []byte) []byte {
+			if n[0] <= len(p) {
+				p = append(p, p[len(p)-n[0]:]...)
+			}
+			return p
+		})
+	case 'k':
+		return ok(func(p []byte) []byte {
+			if len(p) >= 2 {
+				p[0], p[1] = p[1], p[0]
+			}
+			return p
+		})
+	case 'K':
+		return ok(func(p []byte) []byte {
+			if l := len(p); l >= 2 {
+				p[l-1], p[l-2] = p[l-2], p[l-1]
+			}
+			return p
+		})
+	case '*':
+		return ok(func(p []byte) []byte {
+			if n[0] < len(p) && n[1] < len(p) {
+				p[n[0]], p[n[1]] = p[n[1]], p[n[0]]
+			}
+			return p
+		})
+	case 'L':
+		return at(func(p []byte, i int) { p[i] <<= 1 })
+	case 'R':
+		return at(func(p []byte, i int) { p[i] >>= 1 })
+	case '+':
+		return at(func(p []byte, i int) { p[i]++ })
+	case '-':
+		return at(func(p []byte, i int) { p[i]-- })
+	case '.':
+		return at(func(p []byte, i int) {
+			if i+1 < len(p) {
+				p[i] = p[i+1]
+			}
+		})
+	case ',':
+		return at(func(p []byte, i int) {
+			if i > 0 {
+				p[i] = p[i-1]
+			}
+		})
+
+	// rejections
+	case '<':
+		return func(p []byte) ([]byte, bool) { return p, len(p) < n[0] }
+	case '>':
+		return func(p []byte) ([]byte, bool) { return p, len(p) > n[0] }
+	case '_':
+		return func(p []byte) ([]byte, bool) { return p, len(p) == n[0] }
+	case '!':
+		return func(p []byte) ([]byte, bool) { return p, bytes.IndexByte(p, x) < 0 }
+	case '/':
+		return func(p []byte) ([]byte, bool) { return p, bytes.IndexByte(p, x) >= 0 }
+	case '(':
+		return func(p []byte) ([]byte, bool) { return p, len(p) > 0 && p[0] == x }
+	case ')':
+		return func(p []byte) ([]byte, bool) { return p, len(p) > 0 && p[len(p)-1] == x }
+	case '=':
+		return func(p []byte) ([]byte, bool) { return p, n[0] < len(p) && p[n[0]] == x }
+	case '%':
+		return func(p []byte) ([]byte, bool) { return p, bytes.Count(p, []byte{x}) >= n[0] }
+	}
+	panic("unexpected rule function")
+}
+
+// CompileRules compiles the mangling rules from a rule file,
+// in hashcat syntax, selecting one rule on every reduce operation, and
+// applying it to the password, as CompileTransform does.
+// Empty lines and lines starting with # are ignored. Rules using
+// unsupported functions are skipped, and reported.
+func (r *Rainbow) CompileRules(fName string) *Rainbow {
+
+	// Open file
+	f, err := os.Open(fName)
+	if err != nil {
+		panic(err)
+	}
+	defer f.Close()
+
+	var rules []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		rules = append(rules, scanner.Text())
+	}
+	if err = scanner.Err(); err != nil {
+		panic(err)
+	}
+	return r.CompileRuleList(rules...)
+}
+
+// CompileRuleList is like CompileRules, with the rules provided as strings.
+func (r *Rainbow) CompileRuleList(rules ...string) *Rainbow {
+
+	var compiled []*Rule
+	skipped := 0
+	digest := sha256.New()
+	for _, text := range rules {
+		text = strings.TrimRight(text, "\r")
+		if strings.TrimSpace(text) == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		rl, err := ParseRule(text)
+		if err != nil {
+			if skipped == 0 {
+				fmt.Println("Skipping rule :", err)
+			}
+			skipped++
+			continue
+		}
+		compiled = append(compiled, rl)
+		fmt.Fprintln(digest, text)
+	}
+	if skipped > 0 {
+		fmt.Println(skipped, "rules skipped")
+	}
+	if len(compiled) == 0 {
+		panic("there should be at least one valid rule")
+	}
+
+	// rules doing nothing are all equivalent
+	trf := make([]func(p []byte) []byte, len(compiled))
+	for i, rl := range compiled {
+		if strings.Trim(rl.text, ": \t") != "" {
+			trf[i] = rl.Apply
+		}
+	}
+
+	mod := new(rmodule)
+	mod.signature = fmt.Sprintf("CompileRules with %d rules, digest %x", len(compiled), digest.Sum(nil)[:8])
+	mod.bytes = entropyBytes(float64(len(trf)))
+	mod.classes = transformClasses(trf, nil)
+	mod.run = func(d *drawer, p []byte) []byte {
+		// decide on the rule to apply
+		if t := trf[d.draw(uint64(len(trf)))]; t != nil {
+			p = t(p)
+		}
+		return p
+	}
+
+	// add the module
+	r.rms = append(r.rms, mod)
+
+	return r
+}
@@ -0,0 +1,133 @@
+package rainbow
+
+import (
+	"crypto"
+	"math/rand"
+	"testing"
+)
+
+func TestParseRule(t *testing.T) {
+	for _, c := range []struct{ rule, in, out string }{
+		// examples from the hashcat documentation
+		{":", "p@ssW0rd", "p@ssW0rd"},
+		{"l", "p@ssW0rd", "p@ssw0rd"},
+		{"u", "p@ssW0rd", "P@SSW0RD"},
+		{"c", "p@ssW0rd", "P@ssw0rd"},
+		{"C", "p@ssW0rd", "p@SSW0RD"},
+		{"t", "p@ssW0rd", "P@SSw0RD"},
+		{"T3", "p@ssW0rd", "p@sSW0rd"},
+		{"r", "p@ssW0rd", "dr0Wss@p"},
+		{"d", "p@ssW0rd", "p@ssW0rdp@ssW0rd"},
+		{"p2", "p@ssW0rd", "p@ssW0rdp@ssW0rdp@ssW0rd"},
+		{"f", "p@ssW0rd", "p@ssW0rddr0Wss@p"},
+		{"{", "p@ssW0rd", "@ssW0rdp"},
+		{"}", "p@ssW0rd", "dp@ssW0r"},
+		{"$1", "p@ssW0rd", "p@ssW0rd1"},
+		{"^1", "p@ssW0rd", "1p@ssW0rd"},
+		{"[", "p@ssW0rd", "@ssW0rd"},
+		{"]", "p@ssW0rd", "p@ssW0r"},
+		{"D3", "p@ssW0rd", "p@sW0rd"},
+		{"x04", "p@ssW0rd", "p@ss"},
+		{"O12", "p@ssW0rd", "psW0rd"},
+		{"i4!", "p@ssW0rd", "p@ss!W0rd"},
+		{"o3$", "p@ssW0rd", "p@s$W0rd"},
+		{"'6", "p@ssW0rd", "p@ssW0"},
+		{"ss$", "p@ssW0rd", "p@$$W0rd"},
+		{"@s", "p@ssW0rd", "p@W0rd"},
+		{"z2", "p@ssW0rd", "ppp@ssW0rd"},
+		{"Z2", "p@ssW0rd", "p@ssW0rddd"},
+		{"q", "p@ssW0rd", "pp@@ssssWW00rrdd"},
+		{"k", "p@ssW0rd", "@pssW0rd"},
+		{"K", "p@ssW0rd", "p@ssW0dr"},
+		{"*34", "p@ssW0rd", "p@sWs0rd"},
+		{"L2", "p@ssW0rd", "p@\xe6sW0rd"},
+		{"R2", "p@ssW0rd", "p@9sW0rd"},
+		{"+2", "p@ssW0rd", "p@tsW0rd"},
+		{"-1", "p@ssW0rd", "p?ssW0rd"},
+		{".1", "p@ssW0rd", "psssW0rd"},
+		{",1", "p@ssW0rd", "ppssW0rd"},
+		{"y2", "p@ssW0rd", "p@p@ssW0rd"},
+		{"Y2", "p@ssW0rd", "p@ssW0rdrd"},
+		{"E", "p@ssW0rd w0rld", "P@ssw0rd W0rld"},
+		{"e-", "pass-word", "Pass-Word"},
+
+		// combined functions, with or without spaces
+		{"c $1 $2", "pass", "Pass12"},
+		{"c$1$2", "pass", "Pass12"},
+		{"sa@ so0 ^!", "password", "!p@ssw0rd"},
+
+		// out of range positions leave the password unchanged
+		{"TA", "pass", "pass"},
+		{"DZ", "pass", "pass"},
+		{"x39", "pass", "pass"},
+		{"i9!", "pass", "pass"},
+		{"[]", "", ""},
+
+		// rejections leave the password unchanged
+		{"<G $!", "p@ssW0rd", "p@ssW0rd!"},
+		{">8 $!", "p@ssW0rd", "p@ssW0rd"},
+		{"_8 $!", "p@ssW0rd", "p@ssW0rd!"},
+		{"_7 $!", "p@ssW0rd", "p@ssW0rd"},
+		{"!z $!", "p@ssW0rd", "p@ssW0rd!"},
+		{"!s $!", "p@ssW0rd", "p@ssW0rd"},
+		{"/z $!", "p@ssW0rd", "p@ssW0rd"},
+		{"(p $!", "p@ssW0rd", "p@ssW0rd!"},
+		{")p $!", "p@ssW0rd", "p@ssW0rd"},
+		{"=1@ $!", "p@ssW0rd", "p@ssW0rd!"},
+		{"%2s $!", "p@ssW0rd", "p@ssW0rd!"},
+		{"%3s $!", "p@ssW0rd", "p@ssW0rd"},
+		{"u )d", "p@ssW0rd", "p@ssW0rd"},
+
+		// results are limited to 256 bytes
+		{"p9 p9 p9", "pass", "pass"},
+	} {
+		rl, e := ParseRule(c.rule)
+		if e != nil {
+			t.Fatalf("rule %q : %v", c.rule, e)
+		}
+		in := []byte(c.in)
+		if got := string(rl.Apply(in)); got != c.out {
+			t.Fatalf("rule %q on %q : expected %q, got %q", c.rule, c.in, c.out, got)
+		}
+		if string(in) != c.in {
+			t.Fatalf("rule %q modified its input", c.rule)
+		}
+	}
+
+	for _, bad := range []string{"M", "X123", "Q", "$", "T", "sa", "T#", "x1"} {
+		if _, e := ParseRule(bad); e == nil {
+			t.Fatalf("rule %q should not compile", bad)
+		}
+	}
+}
+
+func TestCompileRules(t *testing.T) {
+	r := New(crypto.MD5, 10).CompileWordList("words_test.txt").CompileRules("rules_test.txt")
+	mod := r.rms[1]
+	// the memory rule M is skipped
+	if mod.signature != New(crypto.MD5, 10).CompileRuleList(":", "c", "$1 $2 $3", "sa@ so0", "r", "u").rms[0].signature {
+		t.Fatal("signature should only depend on the compiled rules")
+	}
+	if mod.bytes != 1 {
+		t.Fatalf("expected %d byte of entropy, got %d", 1, mod.bytes)
+	}
+
+	// every rule is selected, uniformly
+	counts := make(map[string]float64)
+	probs := make(map[string]float64)
+	for _, out := range []string{"password", "Password", "password123", "p@ssw0rd", "drowssap", "PASSWORD"} {
+		probs[out] = 1. / 6
+	}
+	rd := rand.New(rand.NewSource(42))
+	ent := make([]byte, mod.bytes+entropySlack)
+	const n = 60_000
+	for i := 0; i < n; i++ {
+		rd.Read(ent)
+		counts[string(runModule(mod, ent, []byte("password")))]++
+	}
+	checkDistribution(t, "rules", counts, probs, n)
+
+	// tables work end to end
+	r = New(crypto.MD5, 20).CompileAlphabet("abcdefghijklmnopqrstuvwxyz", 2, 3).CompileRuleList(":", "u", "$1").Build()
+	checkLookups(t, r, 7)
+}
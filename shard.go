@@ -0,0 +1,214 @@
+package rainbow
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// prefixLimit is the (excluded) upper limit of end point prefixes.
+const prefixLimit = uint64(1) << 32
+
+// endPrefix is the prefix of an end point used for sharding,
+// its first 4 bytes, read as a big endian integer.
+// Since tables are sorted by end, each shard is a contiguous
+// range of the sorted table.
+func endPrefix(end []byte) uint64 {
+	return uint64(binary.BigEndian.Uint32(end))
+}
+
+// Shard is a part of a table, covering a range of end point prefixes.
+// A Table is a Shard. A client to a remote lookup server can also
+// implement Shard, to be queried by a ShardedTable.
+type Shard interface {
+	// Signature of the configuration used to generate the shard.
+	Signature() string
+	// ShardRange is the range of end point prefixes covered,
+	// lo included, hi excluded.
+	ShardRange() (lo, hi uint64)
+	// FindStarts returns the starts of the chains ending with end.
+	FindStarts(end []byte) [][]byte
+}
+
+// ShardRange is the range of end point prefixes covered by the table,
+// lo included, hi excluded.
+func (t *Table) ShardRange() (lo, hi uint64) {
+	return t.lo, t.hi
+}
+
+// ShardIndex returns the shard index of the table,
+// and the total number of shards it was split into.
+// A table that was not split is shard 0 of 1.
+func (t *Table) ShardIndex() (shard, shards int) {
+	return t.shard, t.shards
+}
+
+// Split splits the table file input into len(outputs) shard files,
+// by ranges of end point prefix of equal width.
+// Each shard is a valid table file, with its shard information
+// in the header. Splitting is done on disk, streaming the input.
+// Shards are written to temporary files, renamed once the input is
+// fully read and verified, and removed on error.
+// Chains outside of the range declared by the input are reported as
+// ErrCorrupted.
+func Split(input string, outputs ...string) (err error) {
+	n := len(outputs)
+	if n == 0 {
+		return errors.New("no shard to split into")
+	}
+
+	tr, err := openTableReader(input)
+	if err != nil {
+		return err
+	}
+	defer tr.close()
+
+	// shards of the input range, of equal width
+	lo, hi := tr.fh.lo, tr.fh.hi
+	width := (hi - lo + uint64(n) - 1) / uint64(n)
+	if width == 0 {
+		return errors.New("too many shards for the input range")
+	}
+
+	var tw *tableWriter
+	var tmps []string
+	defer func() {
+		if tw != nil {
+			if e := tw.close(); err == nil {
+				err = e
+			}
+		}
+		for i, tmp := range tmps {
+			if err == nil {
+				err = os.Rename(tmp, outputs[i])
+			}
+			if err != nil {
+				os.Remove(tmp)
+			}
+		}
+	}()
+	for i, out := range outputs {
+		fh := &fileHeader{
+			hsize:     tr.fh.hsize,
+			recsize:   tr.fh.recsize,
+			shard:     i,
+			shards:    n,
+			lo:        lo + uint64(i)*width,
+			hi:        lo + uint64(i+1)*width,
+			signature: tr.fh.signature,
+		}
+		if fh.hi > hi || i == n-1 {
+			fh.hi = hi
+		}
+		if fh.lo > hi {
+			fh.lo = hi
+		}
+		var tmp string
+		if tw, tmp, err = createTempTable(out, fh); err != nil {
+			return err
+		}
+		tmps = append(tmps, tmp)
+
+		// copy the records of the shard
+		for tr.rec != nil {
+			p := endPrefix(tr.rec[tr.fh.hsize:])
+			if p >= fh.hi {
+				break
+			}
+			if p < fh.lo {
+				return errorf(ErrCorrupted, "%s : chains outside of the declared shard range", input)
+			}
+			if err = tw.write(tr.rec); err != nil {
+				return err
+			}
+			if err = tr.next(); err != nil {
+				return err
+			}
+		}
+		fmt.Println(fh.count, "chains in shard", i)
+
+		e := tw.close()
+		tw = nil
+		if e != nil {
+			return e
+		}
+	}
+	if tr.rec != nil {
+		return errorf(ErrCorrupted, "%s : chains outside of the declared shard range", input)
+	}
+	return nil
+}
+
+// ShardedTable is a lookup front-end over a set of shards.
+// For every candidate end point computed during lookup,
+// only the shard covering its prefix is queried.
+// A ShardedTable is safe for concurrent use if its shards are.
+type ShardedTable struct {
+	walker
+	// shards, sorted by increasing range
+	shards []Shard
+}
+
+// NewShardedTable creates a lookup front-end for the shards,
+// that should have been generated with the configuration of r.
+// The shards should not overlap, but do not need to cover all
+// the prefixes : candidates outside of the known shards are ignored.
+func (r *Rainbow) NewShardedTable(shards ...Shard) (*ShardedTable, error) {
+	if r.rf == nil {
+		return nil, errors.New("cannot shard : the reduce function was not built yet")
+	}
+	st := &ShardedTable{walker: r.walker()}
+	st.shards = append(st.shards, shards...)
+	for _, s := range st.shards {
+		if s.Signature() != r.signature {
+			return nil, errors.New("shard signatures do not match")
+		}
+	}
+	sort.Slice(st.shards, func(i, j int) bool {
+		li, _ := st.shards[i].ShardRange()
+		lj, _ := st.shards[j].ShardRange()
+		return li < lj
+	})
+	for i := 1; i < len(st.shards); i++ {
+		_, hp := st.shards[i-1].ShardRange()
+		l, _ := st.shards[i].ShardRange()
+		if l < hp {
+			return nil, errors.New("shard ranges overlap")
+		}
+	}
+	return st, nil
+}
+
+// shardFor returns the shard covering the end point, or nil.
+func (st *ShardedTable) shardFor(end []byte) Shard {
+	p := endPrefix(end)
+	i := sort.Search(len(st.shards), func(i int) bool {
+		_, hi := st.shards[i].ShardRange()
+		return hi > p
+	})
+	if i == len(st.shards) {
+		return nil
+	}
+	if lo, _ := st.shards[i].ShardRange(); lo > p {
+		return nil
+	}
+	return st.shards[i]
+}
+
+// FindStarts returns the starts of the chains ending with end,
+// querying the relevant shard only.
+func (st *ShardedTable) FindStarts(end []byte) [][]byte {
+	s := st.shardFor(end)
+	if s == nil {
+		return nil
+	}
+	return s.FindStarts(end)
+}
+
+// Lookup finds the password p that generated the hash h,
+// if it exists. Found indicates if found.
+func (st *ShardedTable) Lookup(h []byte) (p []byte, found bool) {
+	return st.lookup(h, st.FindStarts)
+}
@@ -0,0 +1,120 @@
+package rainbow
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSplitAndShardedLookup(t *testing.T) {
+	dir := t.TempDir()
+	r := getTestRainbow(20)
+	for i := 0; i < 2_000; i++ {
+		r.AddChain(r.NewChain())
+	}
+	input := filepath.Join(dir, "full.rbw")
+	saveTestTable(t, r, input)
+
+	var outputs []string
+	for i := 0; i < 4; i++ {
+		outputs = append(outputs, filepath.Join(dir, fmt.Sprintf("shard%d.rbw", i)))
+	}
+	if e := Split(input, outputs...); e != nil {
+		t.Fatal(e)
+	}
+
+	// check each shard
+	var shards []Shard
+	var recs []byte
+	for i, out := range outputs {
+		tb, e := getTestRainbow(20).OpenTable(out)
+		if e != nil {
+			t.Fatal(e)
+		}
+		defer tb.Close()
+		if s, n := tb.ShardIndex(); s != i || n != 4 {
+			t.Fatalf("unexpected shard index %d of %d", s, n)
+		}
+		lo, hi := tb.ShardRange()
+		if lo != uint64(i)<<30 || hi != uint64(i+1)<<30 {
+			t.Fatalf("unexpected range for shard %d : %x - %x", i, lo, hi)
+		}
+		for j := 0; j < tb.Len(); j++ {
+			if p := endPrefix(tb.end(j)); p < lo || p >= hi {
+				t.Fatalf("chain %d of shard %d is out of range", j, i)
+			}
+		}
+		recs = append(recs, tb.recs...)
+		// shards are provided in reverse order on purpose
+		shards = append([]Shard{tb}, shards...)
+	}
+	if !bytes.Equal(recs, r.Freeze().recs) {
+		t.Fatal("shards do not add up to the original table")
+	}
+
+	st, e := getTestRainbow(20).NewShardedTable(shards...)
+	if e != nil {
+		t.Fatal(e)
+	}
+	for _, i := range []int{3, 300, 1_500} {
+		psswd, h := r.getPHSample(r.chains[i], 1+i%20)
+		p, found := st.Lookup(h)
+		if !found || !bytes.Equal(r.hf(p, []byte{}), r.hf(psswd, []byte{})) {
+			t.Fatalf("sharded lookup failed for chain %d", i)
+		}
+	}
+
+	// overlapping shards are rejected
+	if _, e := getTestRainbow(20).NewShardedTable(shards[0], shards[0]); e == nil {
+		t.Fatal("overlapping shards should be rejected")
+	}
+
+	// shards can be split further
+	sub := []string{filepath.Join(dir, "sub0.rbw"), filepath.Join(dir, "sub1.rbw")}
+	if e := Split(outputs[1], sub...); e != nil {
+		t.Fatal(e)
+	}
+	tb, e := getTestRainbow(20).OpenTable(sub[1])
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer tb.Close()
+	if lo, hi := tb.ShardRange(); lo != 3<<29 || hi != 4<<29 {
+		t.Fatalf("unexpected sub shard range %x - %x", lo, hi)
+	}
+}
+
+func TestSplitOutOfRange(t *testing.T) {
+	dir := t.TempDir()
+	r := getTestRainbow(20)
+	for i := 0; i < 1_000; i++ {
+		r.AddChain(r.NewChain())
+	}
+	outputs := []string{filepath.Join(dir, "shard0.rbw"), filepath.Join(dir, "shard1.rbw")}
+
+	// chains below, or above, the declared range
+	for _, lohi := range [][2]uint64{{1 << 31, prefixLimit}, {0, 1 << 31}} {
+		tb := r.Freeze()
+		tb.lo, tb.hi = lohi[0], lohi[1]
+		input := filepath.Join(dir, "input.rbw")
+		f, e := os.Create(input)
+		if e != nil {
+			t.Fatal(e)
+		}
+		_, e = tb.WriteTo(f)
+		f.Close()
+		if e != nil {
+			t.Fatal(e)
+		}
+		if e := Split(input, outputs...); !errors.Is(e, ErrCorrupted) {
+			t.Fatalf("range %x : expected %v, got %v", lohi, ErrCorrupted, e)
+		}
+		// no shard, complete or not, is left behind
+		if files, _ := os.ReadDir(dir); len(files) != 1 {
+			t.Fatalf("unexpected files %v", files)
+		}
+	}
+}
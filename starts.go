@@ -0,0 +1,80 @@
+package rainbow
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// Chain starts are derived from a seed and the index of the chain,
+// so that a table only needs the index to restore a start, see the
+// compressed table file format.
+//
+// The first 16 bytes of a start are a = mix(index^seed) and
+// b = mix(a^seed), where mix is a bijection of uint64. Both can be
+// inverted, so the seed and the index are recovered from any start.
+// Longer hashes are padded with further mixes of b.
+
+// constants of the splitmix64 finalizer
+const (
+	mixMul1 uint64 = 0xbf58476d1ce4e5b9
+	mixMul2 uint64 = 0x94d049bb133111eb
+	// golden ratio, steps between the padding words
+	mixGolden uint64 = 0x9e3779b97f4a7c15
+)
+
+// inverses of the multipliers, modulo 2^64
+var mixInv1, mixInv2 = modInverse(mixMul1), modInverse(mixMul2)
+
+// modInverse inverts the odd number a, modulo 2^64, with Newton's method.
+func modInverse(a uint64) uint64 {
+	x := a // correct to 3 bits
+	for i := 0; i < 5; i++ {
+		x *= 2 - a*x
+	}
+	return x
+}
+
+// mix is the splitmix64 finalizer, a bijection.
+func mix(x uint64) uint64 {
+	x ^= x >> 30
+	x *= mixMul1
+	x ^= x >> 27
+	x *= mixMul2
+	return x ^ x>>31
+}
+
+// unmix inverts mix.
+func unmix(x uint64) uint64 {
+	x ^= x>>31 ^ x>>62
+	x *= mixInv2
+	x ^= x>>27 ^ x>>54
+	x *= mixInv1
+	return x ^ x>>30 ^ x>>60
+}
+
+// seededStart derives the start of chain index, for the given seed.
+func seededStart(seed, index uint64, hsize int) []byte {
+	start := make([]byte, (hsize+7)/8*8+8)
+	a := mix(index ^ seed)
+	b := mix(a ^ seed)
+	binary.BigEndian.PutUint64(start, a)
+	binary.BigEndian.PutUint64(start[8:], b)
+	for i := 16; i < hsize; i += 8 {
+		b = mix(b + mixGolden)
+		binary.BigEndian.PutUint64(start[i:], b)
+	}
+	return start[:hsize:hsize]
+}
+
+// startIndex recovers the seed and the index a start was derived from.
+// It reports false if start was not derived with seededStart.
+func startIndex(start []byte) (seed, index uint64, ok bool) {
+	if len(start) < 16 {
+		return 0, 0, false
+	}
+	a := binary.BigEndian.Uint64(start)
+	b := binary.BigEndian.Uint64(start[8:])
+	seed = unmix(b) ^ a
+	index = unmix(a) ^ seed
+	return seed, index, bytes.Equal(seededStart(seed, index, len(start)), start)
+}
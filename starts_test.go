@@ -0,0 +1,50 @@
+package rainbow
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestMix(t *testing.T) {
+	rd := rand.New(rand.NewSource(42))
+	for i := 0; i < 1_000; i++ {
+		x := rd.Uint64()
+		if unmix(mix(x)) != x || mix(unmix(x)) != x {
+			t.Fatalf("mix is not inverted for %x", x)
+		}
+	}
+}
+
+func TestSeededStarts(t *testing.T) {
+	rd := rand.New(rand.NewSource(42))
+	for _, hsize := range []int{16, 20, 28, 32, 64} {
+		seed := rd.Uint64()
+		for _, index := range []uint64{0, 1, 2, 1 << 40, 1<<64 - 1} {
+			start := seededStart(seed, index, hsize)
+			if len(start) != hsize {
+				t.Fatalf("expected %d bytes, got %d", hsize, len(start))
+			}
+			s, i, ok := startIndex(start)
+			if !ok || s != seed || i != index {
+				t.Fatalf("cannot recover seed and index from % X", start)
+			}
+		}
+		// consecutive starts differ in all their words
+		a, b := seededStart(seed, 7, hsize), seededStart(seed, 8, hsize)
+		for i := 0; i+8 <= hsize; i += 8 {
+			if mode.Uint64(a[i:]) == mode.Uint64(b[i:]) {
+				t.Fatalf("word %d is the same for consecutive starts", i/8)
+			}
+		}
+	}
+
+	// random starts longer than 16 bytes are not derived
+	start := make([]byte, 32)
+	rd.Read(start)
+	if _, _, ok := startIndex(start); ok {
+		t.Fatal("random start should not be derived")
+	}
+	if _, _, ok := startIndex(start[:8]); ok {
+		t.Fatal("short start should not be derived")
+	}
+}
@@ -0,0 +1,214 @@
+package rainbow
+
+import (
+	"fmt"
+	"math/bits"
+	"math/rand"
+	"unicode/utf8"
+)
+
+// Substitutions maps runes to the strings that may replace them,
+// such as 'a' to "@" and "4".
+type Substitutions map[rune][]string
+
+// LeetSubstitutions returns a common leetspeak substitution table,
+// for lower case letters.
+func LeetSubstitutions() Substitutions {
+	return Substitutions{
+		'a': {"@", "4"},
+		'b': {"8"},
+		'e': {"3"},
+		'g': {"9"},
+		'i': {"1", "!"},
+		'l': {"1"},
+		'o': {"0"},
+		's': {"$", "5"},
+		't': {"7"},
+	}
+}
+
+// maximum number of variants of a password
+const maxVariants = 1 << 62
+
+// number of passwords sampled to estimate the expansion
+// of a substitution module
+const substitutionSamples = 4096
+
+// substitution is a rune of a password that can be substituted,
+// at p[start:end].
+type substitution struct {
+	start, end int
+	alts       []string
+}
+
+// variants finds the runes of p that can be substituted, and counts
+// ways[i][k], the number of ways to substitute at most k of pos[i:],
+// for k up to max. The last runes are ignored when they would bring
+// the number of variants, ways[0][max], beyond maxVariants, and all
+// is then false.
+func (s Substitutions) variants(p []byte, max int) (pos []substitution, ways [][]uint64, all bool) {
+	// ways to substitute exactly k of the runes kept
+	exact := []uint64{1}
+	all = true
+scan:
+	for i := 0; i < len(p) && max > 0; {
+		c, size := utf8.DecodeRune(p[i:])
+		alts := s[c]
+		if len(alts) > 0 {
+			next := append([]uint64(nil), exact...)
+			if len(next) <= max {
+				next = append(next, 0)
+			}
+			var total uint64
+			for k := range next {
+				if k > 0 {
+					hi, lo := bits.Mul64(exact[k-1], uint64(len(alts)))
+					if hi != 0 || lo > maxVariants {
+						all = false
+						break scan
+					}
+					next[k] += lo
+				}
+				if total += next[k]; total > maxVariants {
+					all = false
+					break scan
+				}
+			}
+			exact = next
+			pos = append(pos, substitution{start: i, end: i + size, alts: alts})
+		}
+		i += size
+	}
+
+	// fill ways from the last rune kept
+	width := len(exact)
+	flat := make([]uint64, (len(pos)+1)*width)
+	ways = make([][]uint64, len(pos)+1)
+	for i := range ways {
+		ways[i] = flat[i*width : (i+1)*width]
+	}
+	for k := range ways[len(pos)] {
+		ways[len(pos)][k] = 1
+	}
+	for i := len(pos) - 1; i >= 0; i-- {
+		ways[i][0] = 1
+		for k := 1; k < width; k++ {
+			ways[i][k] = ways[i+1][k] + uint64(len(pos[i].alts))*ways[i+1][k-1]
+		}
+	}
+	return pos, ways, all
+}
+
+// Variants is the number of variants of p, including p itself, when
+// substituting at most max runes.
+// Variants are capped at 2^62 : the last runes that would bring their
+// number beyond are never substituted, by CompileSubstitution either,
+// and all is then false.
+func (s Substitutions) Variants(p []byte, max int) (n uint64, all bool) {
+	_, ways, all := s.variants(p, max)
+	return ways[0][len(ways[0])-1], all
+}
+
+// CompileSubstitution substitutes at most max runes of the current
+// password, using table, such as LeetSubstitutions, to turn "password"
+// into "p@ssw0rd". Every variant of the password, including the
+// password itself, is as likely. Substitutions apply to the runes of the
+// password, not to the substitutes.
+// The name space is expanded by the number of variants of each password,
+// see Variants, counted over all the passwords of the previous modules
+// when they can enumerate at most 2^20 of them, as word lists and dates
+// do. Otherwise, the expansion is estimated from a sample of passwords,
+// and NamespaceSampled reports it.
+// Name space estimations count each variant once, though substitutes
+// may turn variants, or passwords, into the same password.
+func (r *Rainbow) CompileSubstitution(table Substitutions, max int) *Rainbow {
+	if max < 0 || len(table) == 0 {
+		panic("invalid input parameters")
+	}
+	for c, alts := range table {
+		seen := map[string]bool{string(c): true}
+		for _, a := range alts {
+			if a == "" || seen[a] {
+				panic(fmt.Sprintf("substitutes of %q should be distinct and not empty", c))
+			}
+			seen[a] = true
+		}
+	}
+
+	mod := new(rmodule)
+	mod.signature = fmt.Sprintf("CompileSubstitution with at most %d substitutions, table %q", max, map[rune][]string(table))
+	mod.bytes = entropyBytes(maxVariants)
+	mod.classes, mod.sampled = r.substitutionClasses(table, max)
+	mod.joint = !mod.sampled
+	mod.run = func(d *drawer, p []byte) []byte {
+		pos, ways, _ := table.variants(p, max)
+		k := len(ways[0]) - 1
+
+		// decide on the variant
+		v := d.draw(ways[0][k])
+
+		// build the variant after p, substituting each rune when v
+		// lies beyond the variants leaving it unchanged
+		n := len(p)
+		last := 0
+		for i, s := range pos {
+			if v < ways[i+1][k] {
+				continue
+			}
+			v -= ways[i+1][k]
+			rest := ways[i+1][k-1]
+			p = append(p, p[last:s.start]...)
+			p = append(p, s.alts[v/rest]...)
+			v %= rest
+			last = s.end
+			k--
+		}
+		p = append(p, p[last:n]...)
+		return append(p[:0], p[n:]...)
+	}
+
+	// append the module
+	r.rms = append(r.rms, mod)
+
+	return r
+}
+
+// substitutionClasses computes the joint classes of a substitution module
+// and of the previous modules, from all their passwords when they can be
+// enumerated. Otherwise, sampled is set, and the classes describe the
+// expansion of a sample of passwords, to combine with the classes of the
+// previous modules.
+func (r *Rainbow) substitutionClasses(table Substitutions, max int) (classes []pclass, sampled bool) {
+	if r.enumerate(func(p []byte, q float64) {
+		v, _ := table.Variants(p, max)
+		n := float64(v)
+		classes = append(classes, pclass{p: q / n, n: n})
+		if len(classes) > 2*maxClasses {
+			classes = compactClasses(classes)
+		}
+	}) {
+		return compactClasses(classes), false
+	}
+
+	// sample the passwords of the previous modules
+	rnd := rand.New(rand.NewSource(1))
+	used := entropySlack
+	for _, m := range r.rms {
+		used += m.bytes
+	}
+	var p []byte
+	ent := make([]byte, used)
+	for i := 0; i < substitutionSamples; i++ {
+		p = p[:0]
+		rnd.Read(ent)
+		var d drawer
+		d.init(ent)
+		for _, m := range r.rms {
+			p = m.run(&d, p)
+		}
+		v, _ := table.Variants(p, max)
+		n := float64(v)
+		classes = append(classes, pclass{p: 1 / n, n: n / substitutionSamples})
+	}
+	return compactClasses(classes), true
+}
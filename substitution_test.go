@@ -0,0 +1,116 @@
+package rainbow
+
+import (
+	"crypto"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestSubstitutionVariants(t *testing.T) {
+	leet := LeetSubstitutions()
+	for _, c := range []struct {
+		p    string
+		max  int
+		want uint64
+	}{
+		{"password", 0, 1},
+		{"password", 1, 1 + 7},
+		{"password", 2, 1 + 7 + 18},
+		{"password", 10, 3 * 3 * 3 * 2},
+		{"xyz", 3, 1},
+		{"", 3, 1},
+		{"été", 2, 2},
+	} {
+		if got, all := leet.Variants([]byte(c.p), c.max); got != c.want || !all {
+			t.Fatalf("%q, max %d : expected %d variants, got %d", c.p, c.max, c.want, got)
+		}
+	}
+
+	// beyond 2^62 variants, the last runes are ignored, and reported
+	long := make([]byte, 200)
+	for i := range long {
+		long[i] = 'a'
+	}
+	if v, all := leet.Variants(long, 200); v > maxVariants || v < maxVariants/3 || all {
+		t.Fatalf("unexpected number of variants %d, %v", v, all)
+	}
+	mod := New(crypto.MD5, 10).CompileSubstitution(leet, 200).rms[0]
+	ent := make([]byte, mod.bytes+entropySlack)
+	rand.New(rand.NewSource(42)).Read(ent)
+	if p := runModule(mod, ent, append([]byte{}, long...)); string(p[len(p)-100:]) != string(long[100:]) {
+		t.Fatalf("the last runes were substituted : %q", p)
+	}
+}
+
+func TestCompileSubstitution(t *testing.T) {
+	table := Substitutions{'a': {"@", "4"}, 'o': {"0"}, 's': {"$"}, 'é': {"e"}}
+	mod := New(crypto.MD5, 10).CompileSubstitution(table, 2).rms[0]
+
+	// every variant is as likely
+	const n = 100_000
+	rd := rand.New(rand.NewSource(42))
+	ent := make([]byte, mod.bytes+entropySlack)
+	counts := make(map[string]float64)
+	for i := 0; i < n; i++ {
+		rd.Read(ent)
+		counts[string(runModule(mod, ent, []byte("éspoa")))]++
+	}
+	probs := make(map[string]float64)
+	for _, v := range []string{
+		"éspoa",
+		"espoa", "é$poa", "ésp0a", "éspo@", "éspo4",
+		"e$poa", "esp0a", "espo@", "espo4", "é$p0a", "é$po@", "é$po4", "ésp0@", "ésp04",
+	} {
+		probs[v] = 1. / 15
+	}
+	checkDistribution(t, "substitutions", counts, probs, n)
+
+	// p keeps its capacity, and may be appended to
+	p := make([]byte, 0, 64)
+	p = append(p, "ab"...)
+	rd.Read(ent)
+	if q := runModule(mod, ent, p); &q[0] != &p[0] {
+		t.Fatal("the password was reallocated")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("empty substitutes should be rejected")
+		}
+	}()
+	New(crypto.MD5, 10).CompileSubstitution(Substitutions{'a': {""}}, 1)
+}
+
+func TestSubstitutionNamespace(t *testing.T) {
+	// from all the words
+	r := New(crypto.MD5, 10).CompileWordList("words_test.txt").CompileSubstitution(LeetSubstitutions(), 2)
+	if r.NamespaceSampled() {
+		t.Fatal("word lists should not be sampled")
+	}
+	if s := r.NamespaceSize(); s != 6+4+10+10+10+2 {
+		t.Fatalf("expected %d passwords, got %v", 42, s)
+	}
+	var collision float64
+	for _, v := range []float64{6, 4, 10, 10, 10, 2} {
+		collision += 1. / 36 / v
+	}
+	if e := r.EffectiveNamespaceSize(); math.Abs(e-1/collision) > 1e-9 {
+		t.Fatalf("expected effective size %v, got %v", 1/collision, e)
+	}
+
+	// next modules multiply the name space
+	r.CompileNumberRange(0, 9, 1)
+	if s := r.NamespaceSize(); s != 420 {
+		t.Fatalf("expected %d passwords, got %v", 420, s)
+	}
+
+	// estimated from a sample, 2 variants per a
+	r = New(crypto.MD5, 10).CompileAlphabet("ab", 4, 4).CompileSubstitution(Substitutions{'a': {"4"}}, 4)
+	if !r.NamespaceSampled() {
+		t.Fatal("alphabets should be sampled")
+	}
+	if s := r.NamespaceSize(); math.Abs(s-81)/81 > 0.05 {
+		t.Fatalf("expected about %d passwords, got %v", 81, s)
+	}
+}
@@ -0,0 +1,308 @@
+package rainbow
+
+import (
+	"bytes"
+	"crypto"
+	"sort"
+)
+
+// walker holds what is needed to compute and walk chains,
+// once a Rainbow configuration is frozen.
+// It is shared by the read-only table types.
+type walker struct {
+	// signature of the Rainbow configuration that produced the table
+	signature string
+	// hashing algorithm
+	halgo crypto.Hash
+	// hsize is the size of the hash, in bytes
+	hsize int
+	// rf is the reduce function of the frozen Rainbow
+	rf ReduceFunction
+	// cl is the chain length, or the maximum chain length
+	// in distinguished point mode
+	cl int
+	// number of leading zero bits of distinguished points, 0 if none
+	dp int
+}
+
+// walker for the Rainbow configuration.
+func (r *Rainbow) walker() walker {
+	return walker{
+		signature: r.signature,
+		halgo:     r.halgo,
+		hsize:     r.hsize,
+		rf:        r.rf,
+		cl:        r.cl,
+		dp:        r.dp,
+	}
+}
+
+// size of the chain length metadata, stored after the end
+// of each record in distinguished point mode
+const lengthSize = 4
+
+// size of a single chain record, in bytes
+func (w *walker) recordSize() int {
+	if w.dp > 0 {
+		return 2*w.hsize + lengthSize
+	}
+	return 2 * w.hsize
+}
+
+// appendRecord appends the record of chain c to b.
+func (w *walker) appendRecord(b []byte, c *Chain) []byte {
+	b = append(b, c.start...)
+	b = append(b, c.end...)
+	if w.dp > 0 {
+		b = mode.AppendUint32(b, uint32(c.length))
+	}
+	return b
+}
+
+// chainOf returns the chain stored in rec, sharing its memory.
+func (w *walker) chainOf(rec []byte) *Chain {
+	c := &Chain{start: rec[:w.hsize], end: rec[w.hsize : 2*w.hsize], length: w.cl}
+	if w.dp > 0 {
+		c.length = int(mode.Uint32(rec[2*w.hsize:]))
+	}
+	return c
+}
+
+// step of the reduce function to use at position i of a chain.
+// Distinguished point chains use the same reduce function at every step.
+func (w *walker) step(i int) int {
+	if w.dp > 0 {
+		return 0
+	}
+	return i
+}
+
+// Table is an immutable, read-only rainbow table, meant for serving lookups.
+// It is obtained by freezing a built Rainbow, see Freeze.
+// A Table is safe for concurrent use by multiple goroutines.
+type Table struct {
+	walker
+
+	// recs stores the chains as fixed size records,
+	// start followed by end, sorted by increasing end then start.
+	recs []byte
+	// number of chains in recs
+	n int
+	// mapped is the memory mapped file content, if any
+	mapped []byte
+
+	// shard index and total number of shards
+	shard, shards int
+	// range of end point prefixes covered, lo included, hi excluded
+	lo, hi uint64
+}
+
+// TableStats provides a few statistics about a Table.
+type TableStats struct {
+	// Chains is the number of (distinct) chains
+	Chains int
+	// ChainLength is the length of each chain,
+	// or the maximum length in distinguished point mode
+	ChainLength int
+	// MeanLength is the average length of the chains
+	MeanLength float64
+	// HashSize is the size of the hash, in bytes
+	HashSize int
+	// Bytes is the memory used to store the chains
+	Bytes int
+}
+
+// Freeze turns a built Rainbow into an immutable Table.
+// Chains are copied into a compact storage, sorted and deduplicated.
+// The Rainbow itself is not modified, and can still be used to generate
+// more chains, that will not be visible in the returned Table.
+func (r *Rainbow) Freeze() *Table {
+	if r.rf == nil {
+		panic("cannot freeze : the reduce function was not built yet")
+	}
+
+	t := new(Table)
+	t.walker = r.walker()
+	t.shard, t.shards, t.lo, t.hi = 0, 1, 0, prefixLimit
+
+	// sort a copy of the chains, not to disturb r
+	cc := append([]*Chain{}, r.chains...)
+	sort.Slice(cc, func(i, j int) bool {
+		switch bytes.Compare(cc[i].end, cc[j].end) {
+		case -1:
+			return true
+		case 1:
+			return false
+		}
+		return bytes.Compare(cc[i].start, cc[j].start) < 0
+	})
+
+	// copy into compact storage, skipping identical neighbours
+	rs := t.recordSize()
+	t.recs = make([]byte, 0, rs*len(cc))
+	for i, c := range cc {
+		if i > 0 && c.Equal(cc[i-1]) {
+			continue
+		}
+		t.recs = t.appendRecord(t.recs, c)
+		t.n++
+	}
+
+	return t
+}
+
+// Len is the number of chains in the table.
+func (t *Table) Len() int {
+	return t.n
+}
+
+// Signature is the human readable signature of the configuration
+// used to generate the table.
+func (t *Table) Signature() string {
+	return t.signature
+}
+
+// Stats provides statistics about the table.
+func (t *Table) Stats() TableStats {
+	return TableStats{
+		Chains:      t.n,
+		ChainLength: t.cl,
+		MeanLength:  t.meanLength(),
+		HashSize:    t.hsize,
+		Bytes:       len(t.recs),
+	}
+}
+
+// meanLength is the average chain length.
+// In distinguished point mode, all the records are read.
+func (t *Table) meanLength() float64 {
+	if t.dp == 0 || t.n == 0 {
+		return float64(t.cl)
+	}
+	var sum float64
+	for i := 0; i < t.n; i++ {
+		sum += float64(t.length(i))
+	}
+	return sum / float64(t.n)
+}
+
+// start of chain i
+func (t *Table) start(i int) []byte {
+	rs := t.recordSize()
+	return t.recs[i*rs : i*rs+t.hsize]
+}
+
+// end of chain i
+func (t *Table) end(i int) []byte {
+	rs := t.recordSize()
+	return t.recs[i*rs+t.hsize : i*rs+2*t.hsize]
+}
+
+// length of chain i
+func (t *Table) length(i int) int {
+	rs := t.recordSize()
+	return t.chainOf(t.recs[i*rs : (i+1)*rs]).length
+}
+
+// findChain look for the chains given its ending, using a binary search.
+// return the index of the matching chain, from (included) to (excluded)
+func (t *Table) findChain(endHash []byte) (from, to int, found bool) {
+	from = sort.Search(t.n, func(i int) bool {
+		return bytes.Compare(t.end(i), endHash) >= 0
+	})
+	to = from
+	for to < t.n && bytes.Equal(t.end(to), endHash) {
+		to++
+	}
+	return from, to, to > from
+}
+
+// FindStarts returns the starts of the chains ending with end.
+// The returned slices should not be modified.
+func (t *Table) FindStarts(end []byte) [][]byte {
+	from, to, found := t.findChain(end)
+	if !found {
+		return nil
+	}
+	starts := make([][]byte, 0, to-from)
+	for i := from; i < to; i++ {
+		starts = append(starts, t.start(i))
+	}
+	return starts
+}
+
+// Lookup finds the password p that generated the hash h,
+// if it exists. Found indicates if found.
+// Lookup can be called concurrently.
+func (t *Table) Lookup(h []byte) (p []byte, found bool) {
+	return t.lookup(h, t.FindStarts)
+}
+
+// lookup finds the password p that generated the hash h,
+// using starts to retrieve the chains matching a candidate end point.
+func (w *walker) lookup(h []byte, starts func(end []byte) [][]byte) (p []byte, found bool) {
+
+	// each lookup uses its own hash state
+	hf := getCryptoFunc(w.halgo)
+
+	if w.dp > 0 {
+		return w.dpLookup(hf, h, starts)
+	}
+
+	var buf []byte
+	for depth := 0; depth < w.cl; depth++ {
+		buf = append(buf[0:0], h...)
+
+		// compute the chain ending to look for ...
+		for i := w.cl - depth; i < w.cl; i++ {
+			p = w.rf(i, buf, p)
+			buf = hf(p, buf)
+		}
+		// loop on potential candidates ...
+		for _, start := range starts(buf) {
+			if p, found = w.walkChain(hf, start, h); found {
+				return p, true
+			}
+			// false positive, check other matching chains ...
+		}
+	}
+	return nil, false
+}
+
+// dpLookup finds the password p that generated the hash h,
+// in distinguished point mode. The hash is walked forward until
+// the first distinguished point, the only candidate end point.
+func (w *walker) dpLookup(hf HashFunction, h []byte, starts func(end []byte) [][]byte) (p []byte, found bool) {
+	buf := append([]byte{}, h...)
+	for i := 0; i < w.cl; i++ {
+		if distinguished(buf, w.dp) {
+			for _, start := range starts(buf) {
+				if p, found = w.walkChain(hf, start, h); found {
+					return p, true
+				}
+			}
+			return nil, false
+		}
+		p = w.rf(0, buf, p)
+		buf = hf(p, buf)
+	}
+	return nil, false
+}
+
+// walkChain walks the chain from its start, looking for the password
+// that led to the provided hash h.
+func (w *walker) walkChain(hf HashFunction, start, h []byte) (p []byte, found bool) {
+	buf := append([]byte{}, start...)
+	p = make([]byte, 0, w.hsize)
+	for i := 0; i < w.cl; i++ {
+		p = w.rf(w.step(i), buf, p)
+		buf = hf(p, buf)
+		if bytes.Equal(buf, h) {
+			return p, true
+		}
+		if w.dp > 0 && distinguished(buf, w.dp) {
+			break
+		}
+	}
+	return nil, false
+}
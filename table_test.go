@@ -0,0 +1,91 @@
+package rainbow
+
+import (
+	"bytes"
+	"crypto"
+	"sync"
+	"testing"
+)
+
+func TestFreezeBasic(t *testing.T) {
+	r := getTestRainbow(20)
+	for i := 0; i < 500; i++ {
+		r.AddChain(r.NewChain())
+	}
+	// ensure duplication
+	r.AddChain(r.chains[10], r.chains[20])
+
+	tb := r.Freeze()
+	if tb.Len() != 500 {
+		t.Fatalf("expected 500 chains after freeze, got %d", tb.Len())
+	}
+	if len(r.chains) != 502 {
+		t.Fatal("freezing should not modify the rainbow chains")
+	}
+	if tb.Signature() != r.signature {
+		t.Fatal("signature was not preserved")
+	}
+	st := tb.Stats()
+	if st.Chains != 500 || st.ChainLength != 20 || st.HashSize != 16 || st.Bytes != 500*32 {
+		t.Fatalf("unexpected stats : %+v", st)
+	}
+
+	// ends are sorted
+	for i := 1; i < tb.Len(); i++ {
+		if bytes.Compare(tb.end(i-1), tb.end(i)) > 0 {
+			t.Fatalf("chains %d and %d are not sorted", i-1, i)
+		}
+	}
+
+	// a known password can be retrieved
+	psswd, h := r.getPHSample(r.chains[7], 12)
+	p, found := tb.Lookup(h)
+	if !found || string(p) != string(psswd) {
+		t.Fatal("lookup failed,  retrieving ", string(p), " instead of ", string(psswd))
+	}
+
+	hh := append([]byte{}, h...)
+	hh[0]++
+	if _, found = tb.Lookup(hh); found {
+		t.Fatal("lookup should have failed, but did not ! ")
+	}
+}
+
+func TestFreezeConcurrentLookup(t *testing.T) {
+	r := getTestRainbow(50)
+	for i := 0; i < 200; i++ {
+		r.AddChain(r.NewChain())
+	}
+	tb := r.Freeze()
+
+	// prepare samples, since r itself is not safe for concurrent use
+	hashes := make([][]byte, 80)
+	for i := range hashes {
+		_, hashes[i] = r.getPHSample(r.chains[i], 1+(i*7)%50)
+	}
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			hf := getCryptoFunc(tb.halgo)
+			for i := g * 10; i < (g+1)*10; i++ {
+				p, found := tb.Lookup(hashes[i])
+				if !found || !bytes.Equal(hf(p, []byte{}), hashes[i]) {
+					t.Errorf("concurrent lookup failed for chain %d", i)
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+}
+
+func TestFreezeNotBuilt(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("freezing an unbuilt rainbow should panic")
+		}
+	}()
+	New(crypto.MD5, 10).CompileAlphabet("abc", 1, 2).Freeze()
+}
@@ -0,0 +1,487 @@
+package rainbow
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"sort"
+)
+
+// Table file layout (all integers are little endian) :
+//
+//	magic      4 bytes, "RBWT"
+//	version    uint32
+//	hsize      uint32, size of the hash in bytes
+//	recsize    uint32, size of a chain record in bytes
+//	count      uint64, number of chain records
+//	shard      uint32, index of the shard held in this file
+//	shards     uint32, total number of shards
+//	lo         uint64, lowest end point prefix covered (included)
+//	hi         uint64, highest end point prefix covered (excluded)
+//	siglen     uint64, length of the signature
+//	signature  siglen bytes
+//	records    count fixed size records (start then end),
+//	           sorted by increasing end.
+//	blocksize  uint32, number of records per checksum block
+//	crcs       one CRC-32 (IEEE) per block of records, uint32
+//	digest     32 bytes, SHA-256 file hash, see checksummer
+//
+// The fixed size of the records allows binary search directly
+// on the file content, once memory mapped.
+// A table that is not split is stored as shard 0 of 1,
+// covering all the end point prefixes, see endPrefix.
+
+// magic bytes identifying a table file
+var fileMagic = [4]byte{'R', 'B', 'W', 'T'}
+
+// current version of the file format
+const fileVersion = 3
+
+// size of the fixed part of the header, before the signature
+const fileHeaderFixedSize = 4 + 4 + 4 + 4 + 8 + 4 + 4 + 8 + 8 + 8
+
+// fileHeader is the header of a table file.
+type fileHeader struct {
+	hsize     int
+	recsize   int
+	count     uint64
+	shard     int
+	shards    int
+	lo, hi    uint64
+	signature string
+	// set when the file uses the compressed format
+	compressed bool
+}
+
+// size of the header, in bytes, ie the offset of the first record.
+func (fh *fileHeader) size() int {
+	return fileHeaderFixedSize + len(fh.signature)
+}
+
+// write the header to w.
+func (fh *fileHeader) write(w io.Writer) error {
+	_, e := w.Write(fh.bytes())
+	return e
+}
+
+// bytes is the binary representation of the header.
+func (fh *fileHeader) bytes() []byte {
+	buf := new(bytes.Buffer)
+	buf.Write(fileMagic[:])
+	binary.Write(buf, mode, uint32(fileVersion))
+	binary.Write(buf, mode, uint32(fh.hsize))
+	binary.Write(buf, mode, uint32(fh.recsize))
+	binary.Write(buf, mode, fh.count)
+	binary.Write(buf, mode, uint32(fh.shard))
+	binary.Write(buf, mode, uint32(fh.shards))
+	binary.Write(buf, mode, fh.lo)
+	binary.Write(buf, mode, fh.hi)
+	binary.Write(buf, mode, uint64(len(fh.signature)))
+	buf.WriteString(fh.signature)
+	return buf.Bytes()
+}
+
+// size of the whole file, in bytes.
+func (fh *fileHeader) fileSize() uint64 {
+	return uint64(fh.size()) + fh.count*uint64(fh.recsize) + trailerSize(fh.count)
+}
+
+// readFileHeader reads a header from r.
+// Header values are validated against sane limits,
+// before anything is allocated from them.
+func readFileHeader(r io.Reader) (*fileHeader, error) {
+	fixed := make([]byte, fileHeaderFixedSize)
+	if _, e := io.ReadFull(r, fixed); e != nil {
+		return nil, readError(e, "reading header")
+	}
+	fh := new(fileHeader)
+	switch {
+	case bytes.Equal(fixed[0:4], fileMagic[:]):
+	case bytes.Equal(fixed[0:4], zFileMagic[:]):
+		fh.compressed = true
+	default:
+		return nil, errorf(ErrBadMagic, "expected %q or %q", fileMagic[:], zFileMagic[:])
+	}
+	if v := mode.Uint32(fixed[4:8]); v != fileVersion {
+		return nil, errorf(ErrBadVersion, "version %d", v)
+	}
+	hsize := mode.Uint32(fixed[8:12])
+	recsize := mode.Uint32(fixed[12:16])
+	fh.count = mode.Uint64(fixed[16:24])
+	shard := mode.Uint32(fixed[24:28])
+	shards := mode.Uint32(fixed[28:32])
+	fh.lo = mode.Uint64(fixed[32:40])
+	fh.hi = mode.Uint64(fixed[40:48])
+	sl := mode.Uint64(fixed[48:56])
+
+	switch {
+	case hsize == 0 || hsize > maxHashSize || (fh.compressed && hsize < 8):
+		return nil, errorf(ErrBadHeader, "hash size %d", hsize)
+	case recsize != 2*hsize && recsize != 2*hsize+lengthSize:
+		return nil, errorf(ErrBadHeader, "record size %d", recsize)
+	case fh.count > (1<<62)/uint64(recsize):
+		return nil, errorf(ErrBadHeader, "chain count %d", fh.count)
+	case shards == 0 || shard >= shards:
+		return nil, errorf(ErrBadHeader, "shard %d of %d", shard, shards)
+	case fh.lo > fh.hi || fh.hi > prefixLimit:
+		return nil, errorf(ErrBadHeader, "shard range %x - %x", fh.lo, fh.hi)
+	case sl > maxSignatureLen:
+		return nil, errorf(ErrBadHeader, "signature length %d", sl)
+	}
+	fh.hsize, fh.recsize = int(hsize), int(recsize)
+	fh.shard, fh.shards = int(shard), int(shards)
+
+	sig := make([]byte, sl)
+	if _, e := io.ReadFull(r, sig); e != nil {
+		return nil, readError(e, "reading signature")
+	}
+	fh.signature = string(sig)
+	return fh, nil
+}
+
+// readError converts errors from io.ReadFull or binary.Read,
+// reporting premature ends of file as ErrTruncated.
+func readError(e error, format string, a ...interface{}) error {
+	if e == io.EOF || e == io.ErrUnexpectedEOF {
+		e = ErrTruncated
+	}
+	return errorf(e, format, a...)
+}
+
+// check the header is compatible with the Rainbow r.
+func (r *Rainbow) checkFileHeader(fh *fileHeader) error {
+	if !r.checkSignature(fh.signature) {
+		return errorf(ErrSignatureMismatch, "cannot load")
+	}
+	w := r.walker()
+	if fh.hsize != r.hsize || fh.recsize != w.recordSize() {
+		return errorf(ErrSignatureMismatch, "cannot load, record sizes differ")
+	}
+	return nil
+}
+
+// header for the table t.
+func (t *Table) fileHeader() *fileHeader {
+	return &fileHeader{
+		hsize:     t.hsize,
+		recsize:   t.recordSize(),
+		count:     uint64(t.n),
+		shard:     t.shard,
+		shards:    t.shards,
+		lo:        t.lo,
+		hi:        t.hi,
+		signature: t.signature,
+	}
+}
+
+// WriteTo writes the table to w, using the table file format.
+// It implements the io.WriterTo interface.
+func (t *Table) WriteTo(w io.Writer) (n int64, err error) {
+	buf := bufio.NewWriter(w)
+	fh := t.fileHeader()
+	if err = fh.write(buf); err != nil {
+		return 0, err
+	}
+	n = int64(fh.size())
+	cs := newChecksummer()
+	for i := 0; i < t.n; i++ {
+		rec := t.recs[i*t.recordSize() : (i+1)*t.recordSize()]
+		cs.add(rec)
+		if _, err = buf.Write(rec); err != nil {
+			return n, err
+		}
+		n += int64(len(rec))
+	}
+	nn, err := buf.Write(cs.trailer(fh))
+	n += int64(nn)
+	if err != nil {
+		return n, err
+	}
+	return n, buf.Flush()
+}
+
+// OpenTable opens a table file, previously saved with the same
+// configuration as r, as a read-only Table.
+// The file content is memory mapped when the platform allows it,
+// so lookups can start immediately, whatever the file size,
+// leaving the OS page cache in charge of residency.
+// The returned Table should be closed when no longer needed.
+func (r *Rainbow) OpenTable(fName string) (*Table, error) {
+	if r.rf == nil {
+		return nil, errors.New("cannot open table : the reduce function was not built yet")
+	}
+
+	f, err := os.Open(fName)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	fh, err := readFileHeader(f)
+	if err != nil {
+		return nil, err
+	}
+	if fh.compressed {
+		return nil, errorf(ErrBadMagic, "%s is compressed, see OpenCompressedTable", fName)
+	}
+	if err = r.checkFileHeader(fh); err != nil {
+		return nil, err
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	dataSize := fh.count * uint64(fh.recsize)
+	switch {
+	case uint64(fi.Size()) < fh.fileSize():
+		return nil, errorf(ErrTruncated, "%s", fName)
+	case uint64(fi.Size()) > fh.fileSize():
+		return nil, errorf(ErrCountMismatch, "%s has trailing data", fName)
+	}
+
+	data, err := mmapFile(f, int(fi.Size()))
+	if err != nil {
+		return nil, err
+	}
+
+	t := new(Table)
+	t.walker = r.walker()
+	t.shard, t.shards, t.lo, t.hi = fh.shard, fh.shards, fh.lo, fh.hi
+	t.n = int(fh.count)
+	t.recs = data[fh.size() : uint64(fh.size())+dataSize]
+	t.mapped = data
+	return t, nil
+}
+
+// Close releases the resources associated with a table opened
+// with OpenTable. The table cannot be used afterwards.
+// Closing a frozen, in-memory table does nothing.
+func (t *Table) Close() error {
+	if t.mapped == nil {
+		return nil
+	}
+	e := munmapFile(t.mapped)
+	t.mapped, t.recs, t.n = nil, nil, 0
+	return e
+}
+
+// tableWriter streams sorted records into a new table file.
+// The header is rewritten with the final count when closing.
+type tableWriter struct {
+	f  *os.File
+	w  *bufio.Writer
+	fh *fileHeader
+	cs *checksummer
+}
+
+// createTable creates the table file fName, with header fh.
+// The count in fh is updated as records are written.
+func createTable(fName string, fh *fileHeader) (*tableWriter, error) {
+	f, err := os.Create(fName)
+	if err != nil {
+		return nil, err
+	}
+	fh.count = 0
+	if err = fh.write(f); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &tableWriter{f: f, w: bufio.NewWriter(f), fh: fh, cs: newChecksummer()}, nil
+}
+
+// write a single record.
+func (tw *tableWriter) write(rec []byte) error {
+	if _, e := tw.w.Write(rec); e != nil {
+		return e
+	}
+	tw.cs.add(rec)
+	tw.fh.count++
+	return nil
+}
+
+// close writes the trailer, rewrites the header, and closes the file.
+func (tw *tableWriter) close() error {
+	_, err := tw.w.Write(tw.cs.trailer(tw.fh))
+	if err == nil {
+		err = tw.w.Flush()
+	}
+	if err == nil {
+		_, err = tw.f.Seek(0, io.SeekStart)
+	}
+	if err == nil {
+		err = tw.fh.write(tw.f)
+	}
+	if e := tw.f.Close(); err == nil {
+		err = e
+	}
+	return err
+}
+
+// tableReader streams the records of a table file, in order,
+// verifying the checksums as it goes.
+type tableReader struct {
+	// name of the source, for error messages
+	name string
+	buf  *bufio.Reader
+	fh   *fileHeader
+	cs   *checksummer
+	// number of records read so far
+	read uint64
+	// current record, nil when exhausted
+	rec []byte
+	// set once the trailer is verified
+	done bool
+	// decoder, for compressed files
+	z *zStream
+	// closer, if any
+	c io.Closer
+	// bytes read from the source
+	cr *countingReader
+}
+
+// countingReader counts the bytes read from r.
+type countingReader struct {
+	r io.Reader
+	n uint64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, e := cr.r.Read(p)
+	cr.n += uint64(n)
+	return n, e
+}
+
+// newTableReader reads the header from rd, positioned on the first record.
+func newTableReader(name string, rd io.Reader) (*tableReader, error) {
+	tr := &tableReader{name: name, cr: &countingReader{r: rd}, cs: newChecksummer()}
+	tr.buf = bufio.NewReader(tr.cr)
+	var err error
+	if tr.fh, err = readFileHeader(tr.buf); err != nil {
+		return nil, errorf(err, "%s", name)
+	}
+	if tr.fh.compressed {
+		tr.z = &zStream{rd: tr.buf, hsize: tr.fh.hsize, recsize: tr.fh.recsize, left: tr.fh.count, nb: zBlocks(tr.fh.count)}
+	}
+	if err = tr.next(); err != nil {
+		return nil, err
+	}
+	return tr, nil
+}
+
+// openTableReader opens a table file, positioned on its first record.
+func openTableReader(fName string) (*tableReader, error) {
+	f, err := os.Open(fName)
+	if err != nil {
+		return nil, err
+	}
+	tr, err := newTableReader(fName, f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	tr.c = f
+	return tr, nil
+}
+
+// checkEOF checks nothing follows the trailer.
+func (tr *tableReader) checkEOF() error {
+	if _, e := tr.buf.ReadByte(); e != io.EOF {
+		return errorf(ErrCountMismatch, "%s, unexpected data after %d chains", tr.name, tr.fh.count)
+	}
+	return nil
+}
+
+// close the underlying file, if any.
+func (tr *tableReader) close() error {
+	if tr.c == nil {
+		return nil
+	}
+	return tr.c.Close()
+}
+
+// next reads the next record, checking records are properly sorted.
+// Once all records are read, the trailer is read and verified.
+func (tr *tableReader) next() error {
+	if e := tr.advance(); e != nil {
+		return tr.checkCount(e)
+	}
+	return nil
+}
+
+// checkCount turns e, met while reading an uncompressed file, into
+// ErrCountMismatch when the file holds fewer chains than its header
+// declares, or into ErrTruncated when it ends prematurely, rather than
+// reporting the trailer read as chains as corruption.
+func (tr *tableReader) checkCount(e error) error {
+	if tr.z != nil || !(errors.Is(e, ErrCorrupted) || errors.Is(e, ErrTruncated)) {
+		return e
+	}
+	io.Copy(io.Discard, tr.buf)
+	size := tr.cr.n
+	if size >= tr.fh.fileSize() {
+		return e
+	}
+	// the number of chains the file holds, if its size is consistent
+	fh := *tr.fh
+	fh.count = uint64(sort.Search(int(tr.fh.count), func(i int) bool {
+		fh.count = uint64(i)
+		return fh.fileSize() >= size
+	}))
+	if fh.fileSize() == size {
+		return errorf(ErrCountMismatch, "%s declares %d chains, holds %d", tr.name, tr.fh.count, fh.count)
+	}
+	return errorf(ErrTruncated, "%s declares %d chains, ends prematurely", tr.name, tr.fh.count)
+}
+
+// advance reads the next record, see next.
+func (tr *tableReader) advance() error {
+	if tr.read == tr.fh.count {
+		tr.rec = nil
+		if !tr.done {
+			if tr.z != nil {
+				if e := tr.z.skipIndex(); e != nil {
+					return errorf(e, "%s", tr.name)
+				}
+			}
+			if e := tr.cs.verify(tr.fh, tr.buf); e != nil {
+				return errorf(e, "%s", tr.name)
+			}
+			tr.done = true
+		}
+		return nil
+	}
+	var rec []byte
+	if tr.z != nil {
+		var e error
+		if rec, e = tr.z.next(); e != nil {
+			return errorf(e, "%s, decoding chain %d of %d", tr.name, tr.read, tr.fh.count)
+		}
+	} else {
+		rec = make([]byte, tr.fh.recsize)
+		if _, e := io.ReadFull(tr.buf, rec); e != nil {
+			return readError(e, "%s, reading chain %d of %d", tr.name, tr.read, tr.fh.count)
+		}
+	}
+	if tr.rec != nil && compareRecords(tr.rec, rec, tr.fh.hsize) > 0 {
+		return errorf(ErrCorrupted, "%s, chain %d is not sorted", tr.name, tr.read)
+	}
+	tr.cs.add(rec)
+	tr.rec = rec
+	tr.read++
+	return nil
+}
+
+// compareRecords compares records by end first, then by start.
+func compareRecords(a, b []byte, hsize int) int {
+	if c := bytes.Compare(a[hsize:2*hsize], b[hsize:2*hsize]); c != 0 {
+		return c
+	}
+	if c := bytes.Compare(a[:hsize], b[:hsize]); c != 0 {
+		return c
+	}
+	return bytes.Compare(a[2*hsize:], b[2*hsize:])
+}
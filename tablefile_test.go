@@ -0,0 +1,101 @@
+package rainbow
+
+import (
+	"bytes"
+	"crypto"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOpenTable(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "mapped.rbw")
+
+	r := getTestRainbow(30)
+	for i := 0; i < 1_000; i++ {
+		r.AddChain(r.NewChain())
+	}
+	f, e := os.Create(fname)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if e = r.Save(f); e != nil {
+		t.Fatal(e)
+	}
+	f.Close()
+
+	tb, e := getTestRainbow(30).OpenTable(fname)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer tb.Close()
+
+	if tb.Len() != 1_000 {
+		t.Fatalf("expected 1000 chains, got %d", tb.Len())
+	}
+	frozen := r.Freeze()
+	if !bytes.Equal(frozen.recs, tb.recs) {
+		t.Fatal("mapped records differ from frozen records")
+	}
+
+	for _, i := range []int{0, 17, 512, 999} {
+		psswd, h := r.getPHSample(r.chains[i], 1+i%30)
+		p, found := tb.Lookup(h)
+		if !found || !bytes.Equal(r.hf(p, []byte{}), r.hf(psswd, []byte{})) {
+			t.Fatalf("lookup failed on mapped table for chain %d", i)
+		}
+	}
+
+	if e = tb.Close(); e != nil {
+		t.Fatal(e)
+	}
+	if tb.Len() != 0 {
+		t.Fatal("closed table should be empty")
+	}
+}
+
+func TestOpenTableMismatch(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "mismatch.rbw")
+	r := getTestRainbow(30)
+	for i := 0; i < 10; i++ {
+		r.AddChain(r.NewChain())
+	}
+	f, _ := os.Create(fname)
+	r.Save(f)
+	f.Close()
+
+	rr := New(crypto.MD5, 30).CompileAlphabet("abc", 2, 3).Build()
+	if _, e := rr.OpenTable(fname); e == nil {
+		t.Fatal("opening a table with a different signature should fail")
+	}
+
+	// truncated file
+	data, _ := os.ReadFile(fname)
+	os.WriteFile(fname, data[:len(data)-5], 0644)
+	if _, e := getTestRainbow(30).OpenTable(fname); e == nil {
+		t.Fatal("opening a truncated table should fail")
+	}
+
+	// not a table
+	os.WriteFile(fname, []byte("hello world, this is not a table file"), 0644)
+	if _, e := getTestRainbow(30).OpenTable(fname); e == nil {
+		t.Fatal("opening a non table file should fail")
+	}
+}
+
+func TestOpenTableEmpty(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "empty.rbw")
+	r := getTestRainbow(10)
+	f, _ := os.Create(fname)
+	r.Save(f)
+	f.Close()
+
+	tb, e := getTestRainbow(10).OpenTable(fname)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer tb.Close()
+	if _, found := tb.Lookup(make([]byte, 16)); found || tb.Len() != 0 {
+		t.Fatal("empty table should not find anything")
+	}
+}
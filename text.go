@@ -0,0 +1,191 @@
+package rainbow
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Text table layout, one chain per line :
+//
+//	# go-rainbow text table
+//	# signature "quoted signature"
+//	# hash size 16
+//	# chains 3
+//	<hex start> <hex end>
+//	...
+//
+// In distinguished point mode, each chain line also holds the chain
+// length, in decimal, after the end.
+// Lines starting with # are comments. The signature, hash size and
+// chains comments are checked on import when present, and ignored
+// otherwise, so hand written files only need the chain lines.
+
+// ExportText reads a table file, plain or compressed, from reader,
+// and writes its chains to w, in the text table format.
+// The table file is checked as it is read, like Verify does.
+func ExportText(w io.Writer, reader io.Reader) error {
+	tr, err := newTableReader("table", reader)
+	if err != nil {
+		return err
+	}
+	buf := bufio.NewWriter(w)
+	fmt.Fprintln(buf, "# go-rainbow text table")
+	fmt.Fprintln(buf, "# signature", strconv.Quote(tr.fh.signature))
+	fmt.Fprintln(buf, "# hash size", tr.fh.hsize)
+	fmt.Fprintln(buf, "# chains", tr.fh.count)
+	for tr.rec != nil {
+		hs := tr.fh.hsize
+		if tr.fh.recsize > 2*hs {
+			fmt.Fprintf(buf, "%x %x %d\n", tr.rec[:hs], tr.rec[hs:2*hs], mode.Uint32(tr.rec[2*hs:]))
+		} else {
+			fmt.Fprintf(buf, "%x %x\n", tr.rec[:hs], tr.rec[hs:])
+		}
+		if err = tr.next(); err != nil {
+			return err
+		}
+	}
+	if err = tr.checkEOF(); err != nil {
+		return err
+	}
+	return buf.Flush()
+}
+
+// ImportText adds to r the chains read from a text table,
+// such as produced by ExportText.
+// Errors wrap ErrSignatureMismatch or ErrCountMismatch when the header
+// comments do not match, and ErrCorrupted for lines that cannot be parsed.
+// On error, no chains are added.
+func (r *Rainbow) ImportText(reader io.Reader) error {
+	sc := bufio.NewScanner(reader)
+	// quoting may expand the signature up to 4 times
+	sc.Buffer(nil, 4*maxSignatureLen+64)
+	count, declared := uint64(0), int64(-1)
+	var chains []*Chain
+	var e error
+	for ln := 1; e == nil && sc.Scan(); ln++ {
+		line := strings.TrimSpace(sc.Text())
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "#"):
+			e = r.checkTextComment(strings.TrimSpace(line[1:]), &declared)
+			if e != nil {
+				e = errorf(e, "line %d", ln)
+			}
+		default:
+			c, ee := r.parseTextChain(line)
+			if ee != nil {
+				e = errorf(ee, "line %d", ln)
+			} else {
+				chains = append(chains, c)
+				count++
+			}
+		}
+	}
+	if e == nil {
+		e = sc.Err()
+	}
+	if e == nil && declared >= 0 && uint64(declared) != count {
+		e = errorf(ErrCountMismatch, "%d chains declared, %d found", declared, count)
+	}
+	if e != nil {
+		return e
+	}
+	r.AddChain(chains...)
+	fmt.Println(count, "chains imported")
+	r.DedupChains()
+	return nil
+}
+
+// checkTextComment checks a header comment against r,
+// recording the declared number of chains.
+func (r *Rainbow) checkTextComment(c string, declared *int64) error {
+	switch {
+	case strings.HasPrefix(c, "signature "):
+		sig, e := strconv.Unquote(strings.TrimPrefix(c, "signature "))
+		if e != nil {
+			return errorf(ErrCorrupted, "invalid signature")
+		}
+		if !r.checkSignature(sig) {
+			return errorf(ErrSignatureMismatch, "cannot import")
+		}
+	case strings.HasPrefix(c, "hash size "):
+		if strings.TrimPrefix(c, "hash size ") != strconv.Itoa(r.hsize) {
+			return errorf(ErrSignatureMismatch, "hash sizes differ")
+		}
+	case strings.HasPrefix(c, "chains "):
+		n, e := strconv.ParseInt(strings.TrimPrefix(c, "chains "), 10, 64)
+		if e != nil || n < 0 {
+			return errorf(ErrCorrupted, "invalid number of chains")
+		}
+		*declared = n
+	}
+	return nil
+}
+
+// parseTextChain parses a "<hex start> <hex end> [length]" line.
+func (r *Rainbow) parseTextChain(line string) (*Chain, error) {
+	f := strings.Fields(line)
+	switch {
+	case r.dp == 0 && len(f) != 2:
+		return nil, errorf(ErrCorrupted, "expected a start and an end")
+	case r.dp > 0 && len(f) != 3:
+		return nil, errorf(ErrCorrupted, "expected a start, an end and a length")
+	}
+	c := &Chain{length: r.cl}
+	var e1, e2 error
+	c.start, e1 = hex.DecodeString(f[0])
+	c.end, e2 = hex.DecodeString(f[1])
+	if e1 != nil || e2 != nil || len(c.start) != r.hsize || len(c.end) != r.hsize {
+		return nil, errorf(ErrCorrupted, "expected two %d bytes hex values", r.hsize)
+	}
+	if r.dp > 0 {
+		n, e := strconv.ParseUint(f[2], 10, 32)
+		if e != nil || n == 0 || int(n) > r.cl {
+			return nil, errorf(ErrCorrupted, "invalid chain length %q", f[2])
+		}
+		c.length = int(n)
+	}
+	return c, nil
+}
+
+// ExportRT reads a table file, plain or compressed, from reader,
+// and writes its chains to w using the RainbowCrack .rt record layout :
+// for each chain, the start point then the end point, as little endian
+// uint64, sorted by end point.
+//
+// The .rt format stores 8 bytes per point, while starts and ends here
+// are full hashes. Each point is exported as its first 8 bytes, read
+// as a big endian uint64, which keeps the file sorted by end point.
+// The export is thus lossy, and meant for inspection with tools that
+// understand the .rt layout. RainbowCrack itself cannot use the chains,
+// since its reduce functions differ.
+func ExportRT(w io.Writer, reader io.Reader) error {
+	tr, err := newTableReader("table", reader)
+	if err != nil {
+		return err
+	}
+	if tr.fh.hsize < 8 {
+		return fmt.Errorf("cannot export hashes shorter than 8 bytes")
+	}
+	buf := bufio.NewWriter(w)
+	rec := make([]byte, 16)
+	for tr.rec != nil {
+		mode.PutUint64(rec[:8], binary.BigEndian.Uint64(tr.rec[:8]))
+		mode.PutUint64(rec[8:], binary.BigEndian.Uint64(tr.rec[tr.fh.hsize:]))
+		if _, err = buf.Write(rec); err != nil {
+			return err
+		}
+		if err = tr.next(); err != nil {
+			return err
+		}
+	}
+	if err = tr.checkEOF(); err != nil {
+		return err
+	}
+	return buf.Flush()
+}
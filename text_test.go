@@ -0,0 +1,103 @@
+package rainbow
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestTextRoundTrip(t *testing.T) {
+	r := getTestRainbow(20)
+	for i := 0; i < 500; i++ {
+		r.AddChain(r.NewChain())
+	}
+	for _, compressed := range []bool{false, true} {
+		tf := new(bytes.Buffer)
+		if compressed {
+			r.Freeze().WriteCompressed(tf)
+		} else {
+			r.Freeze().WriteTo(tf)
+		}
+		txt := new(bytes.Buffer)
+		if e := ExportText(txt, tf); e != nil {
+			t.Fatal(e)
+		}
+		lines := strings.Split(strings.TrimSpace(txt.String()), "\n")
+		if len(lines) != 4+500 || !strings.HasPrefix(lines[1], "# signature") {
+			t.Fatalf("unexpected text export :\n%s", strings.Join(lines[:5], "\n"))
+		}
+
+		rr := getTestRainbow(20)
+		if e := rr.ImportText(txt); e != nil {
+			t.Fatal(e)
+		}
+		if !bytes.Equal(rr.Freeze().recs, r.Freeze().recs) {
+			t.Fatal("imported chains differ from exported chains")
+		}
+	}
+}
+
+func TestImportTextErrors(t *testing.T) {
+	r := getTestRainbow(20)
+	r.AddChain(r.NewChain())
+	tf, txt := new(bytes.Buffer), new(bytes.Buffer)
+	r.Save(tf)
+	ExportText(txt, tf)
+	good := txt.String()
+	chain := strings.Split(good, "\n")[4]
+
+	for _, c := range []struct {
+		text string
+		err  error
+	}{
+		{"# signature \"other\"\n" + chain, ErrSignatureMismatch},
+		{"# hash size 20\n" + chain, ErrSignatureMismatch},
+		{"# chains 2\n" + chain, ErrCountMismatch},
+		{"abcd " + chain, ErrCorrupted},
+		{chain[:10] + " " + chain[10:], ErrCorrupted},
+		{"zz" + chain[2:], ErrCorrupted},
+	} {
+		rr := getTestRainbow(20)
+		if e := rr.ImportText(strings.NewReader(c.text)); !errors.Is(e, c.err) {
+			t.Fatalf("importing %q, expected %v, got %v", c.text, c.err, e)
+		}
+		if len(rr.chains) != 0 {
+			t.Fatalf("importing %q, %d chains were added", c.text, len(rr.chains))
+		}
+	}
+
+	// chain lines are enough
+	rr := getTestRainbow(20)
+	if e := rr.ImportText(strings.NewReader("\n" + chain + "\n")); e != nil || len(rr.chains) != 1 {
+		t.Fatal("importing a bare chain line failed : ", e)
+	}
+}
+
+func TestExportRT(t *testing.T) {
+	r := getTestRainbow(20)
+	for i := 0; i < 300; i++ {
+		r.AddChain(r.NewChain())
+	}
+	tf, rt := new(bytes.Buffer), new(bytes.Buffer)
+	frozen := r.Freeze()
+	frozen.WriteTo(tf)
+	if e := ExportRT(rt, tf); e != nil {
+		t.Fatal(e)
+	}
+	data := rt.Bytes()
+	if len(data) != 16*frozen.Len() {
+		t.Fatalf("expected %d bytes, got %d", 16*frozen.Len(), len(data))
+	}
+	for i := 0; i < frozen.Len(); i++ {
+		start := binary.LittleEndian.Uint64(data[16*i:])
+		end := binary.LittleEndian.Uint64(data[16*i+8:])
+		if start != binary.BigEndian.Uint64(frozen.start(i)) || end != binary.BigEndian.Uint64(frozen.end(i)) {
+			t.Fatalf("record %d does not match", i)
+		}
+		if i > 0 && end < binary.LittleEndian.Uint64(data[16*i-8:]) {
+			t.Fatalf("record %d is not sorted by end point", i)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package rainbow
+
+import (
+	"crypto"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"strconv"
+	"time"
+)
+
+// TradeoffConfig is a point of the time-memory tradeoff grid,
+// measured by MeasureTradeoff.
+type TradeoffConfig struct {
+	// Hash algorithm, MD5 if zero
+	Hash crypto.Hash
+	// Alphabet, MinLen and MaxLen define the password name space,
+	// see CompileAlphabet
+	Alphabet       string
+	MinLen, MaxLen int
+	// ChainLength and Chains define the table
+	ChainLength, Chains int
+	// Lookups is the number of random passwords looked up
+	Lookups int
+	// Seed of the random generators, for reproducible runs
+	Seed int64
+}
+
+// TradeoffResult holds the measures for a TradeoffConfig.
+type TradeoffResult struct {
+	TradeoffConfig
+	// Namespace is the number of distinct passwords
+	Namespace float64
+	// Generation is the time spent generating the chains
+	Generation time.Duration
+	// ChainsPerSec and HashesPerSec measure generation throughput
+	ChainsPerSec, HashesPerSec float64
+	// LookupLatency is the mean duration of a lookup
+	LookupLatency time.Duration
+	// SuccessRate is the fraction of lookups that found the password
+	SuccessRate float64
+	// FalseAlarms is the mean number of chains walked in vain, per lookup
+	FalseAlarms float64
+	// TableBytes is the size of the frozen table
+	TableBytes int
+}
+
+// MeasureTradeoff builds a table for cfg, and measures generation
+// throughput, lookup latency, success rate and false alarms.
+// Passwords looked up are drawn like CompileAlphabet draws them :
+// a uniform length, then uniform characters.
+func MeasureTradeoff(cfg TradeoffConfig) TradeoffResult {
+	if cfg.Hash == 0 {
+		cfg.Hash = crypto.MD5
+	}
+	res := TradeoffResult{TradeoffConfig: cfg}
+	alpha := []rune(cfg.Alphabet)
+	for l := cfg.MinLen; l <= cfg.MaxLen; l++ {
+		res.Namespace += math.Pow(float64(len(alpha)), float64(l))
+	}
+
+	r := New(cfg.Hash, cfg.ChainLength).CompileAlphabet(cfg.Alphabet, cfg.MinLen, cfg.MaxLen).Build()
+	r.rand = rand.New(rand.NewSource(cfg.Seed))
+
+	// generation
+	start := time.Now()
+	for i := 0; i < cfg.Chains; i++ {
+		r.AddChain(r.NewChain())
+	}
+	res.Generation = time.Since(start)
+	if s := res.Generation.Seconds(); s > 0 {
+		res.ChainsPerSec = float64(cfg.Chains) / s
+		res.HashesPerSec = float64(cfg.Chains) * float64(cfg.ChainLength) / s
+	}
+	t := r.Freeze()
+	res.TableBytes = t.Stats().Bytes
+
+	// lookups, counting the candidate chains walked
+	rd := rand.New(rand.NewSource(cfg.Seed + 1))
+	hf := getCryptoFunc(cfg.Hash)
+	candidates, found := 0, 0
+	starts := func(end []byte) [][]byte {
+		s := t.FindStarts(end)
+		candidates += len(s)
+		return s
+	}
+	var elapsed time.Duration
+	for i := 0; i < cfg.Lookups; i++ {
+		p := make([]rune, cfg.MinLen+rd.Intn(cfg.MaxLen-cfg.MinLen+1))
+		for j := range p {
+			p[j] = alpha[rd.Intn(len(alpha))]
+		}
+		h := hf([]byte(string(p)), nil)
+		start := time.Now()
+		if _, ok := t.lookup(h, starts); ok {
+			found++
+		}
+		elapsed += time.Since(start)
+	}
+	if cfg.Lookups > 0 {
+		res.LookupLatency = elapsed / time.Duration(cfg.Lookups)
+		res.SuccessRate = float64(found) / float64(cfg.Lookups)
+		res.FalseAlarms = float64(candidates-found) / float64(cfg.Lookups)
+	}
+	return res
+}
+
+// tradeoffHeader lists the CSV columns written by WriteTradeoffCSV.
+var tradeoffHeader = []string{
+	"version", "hash", "alphabet_size", "min_len", "max_len", "namespace",
+	"chain_length", "chains", "lookups",
+	"generation_s", "chains_per_s", "hashes_per_s",
+	"lookup_us", "success_rate", "false_alarms", "table_bytes",
+}
+
+// WriteTradeoffCSV measures each configuration in turn, and writes
+// the results to w as CSV, with a header line.
+// Each row is written as soon as it is measured.
+func WriteTradeoffCSV(w io.Writer, cfgs ...TradeoffConfig) error {
+	cw := csv.NewWriter(w)
+	if e := cw.Write(tradeoffHeader); e != nil {
+		return e
+	}
+	cw.Flush()
+	for _, cfg := range cfgs {
+		res := MeasureTradeoff(cfg)
+		row := []string{
+			VersionString(),
+			res.Hash.String(),
+			strconv.Itoa(len([]rune(res.Alphabet))),
+			strconv.Itoa(res.MinLen),
+			strconv.Itoa(res.MaxLen),
+			strconv.FormatFloat(res.Namespace, 'g', -1, 64),
+			strconv.Itoa(res.ChainLength),
+			strconv.Itoa(res.Chains),
+			strconv.Itoa(res.Lookups),
+			fmt.Sprintf("%.3f", res.Generation.Seconds()),
+			fmt.Sprintf("%.1f", res.ChainsPerSec),
+			fmt.Sprintf("%.1f", res.HashesPerSec),
+			fmt.Sprintf("%.1f", float64(res.LookupLatency.Nanoseconds())/1e3),
+			fmt.Sprintf("%.4f", res.SuccessRate),
+			fmt.Sprintf("%.3f", res.FalseAlarms),
+			strconv.Itoa(res.TableBytes),
+		}
+		if e := cw.Write(row); e != nil {
+			return e
+		}
+		cw.Flush()
+		if e := cw.Error(); e != nil {
+			return e
+		}
+	}
+	return nil
+}
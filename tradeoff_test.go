@@ -0,0 +1,52 @@
+package rainbow
+
+import (
+	"bytes"
+	"encoding/csv"
+	"strconv"
+	"testing"
+)
+
+func TestWriteTradeoffCSV(t *testing.T) {
+	var cfgs []TradeoffConfig
+	for _, chains := range []int{50, 500} {
+		cfgs = append(cfgs, TradeoffConfig{
+			Alphabet: "abcdefghijklmnopqrstuvwxyz", MinLen: 2, MaxLen: 3,
+			ChainLength: 20, Chains: chains, Lookups: 100, Seed: 1,
+		})
+	}
+	buf := new(bytes.Buffer)
+	if e := WriteTradeoffCSV(buf, cfgs...); e != nil {
+		t.Fatal(e)
+	}
+	rows, e := csv.NewReader(buf).ReadAll()
+	if e != nil {
+		t.Fatal(e)
+	}
+	if len(rows) != 3 || len(rows[0]) != len(tradeoffHeader) {
+		t.Fatalf("unexpected csv :\n%v", rows)
+	}
+	col := func(row []string, name string) float64 {
+		for i, h := range tradeoffHeader {
+			if h == name {
+				v, e := strconv.ParseFloat(row[i], 64)
+				if e != nil {
+					t.Fatal(e)
+				}
+				return v
+			}
+		}
+		t.Fatal("no column ", name)
+		return 0
+	}
+	if ns := col(rows[1], "namespace"); ns != 26*26+26*26*26 {
+		t.Fatalf("unexpected namespace %v", ns)
+	}
+	small, large := col(rows[1], "success_rate"), col(rows[2], "success_rate")
+	if small < 0 || large > 1 || large <= small {
+		t.Fatalf("unexpected success rates %v and %v", small, large)
+	}
+	if col(rows[2], "hashes_per_s") <= 0 || col(rows[2], "false_alarms") < 0 {
+		t.Fatal("unexpected throughput or false alarms")
+	}
+}
@@ -0,0 +1,190 @@
+package rainbow
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// CompileWeightedWordList will load a weighted word list from file,
+// and select one word on every reduce operation, with a probability
+// proportional to its weight. The selected word is appended to the
+// current password.
+// Each line of the file holds a word, a tab, and its weight, a positive
+// integer, such as the count of a word in a leaked password list.
+// Lines without a tab are words of weight 1. Empty lines, and words of
+// weight 0, are ignored.
+func (r *Rainbow) CompileWeightedWordList(fName string) *Rainbow {
+
+	// Open file
+	f, err := os.Open(fName)
+	if err != nil {
+		panic(err)
+	}
+	defer f.Close()
+
+	// scan words, accumulating weights
+	var words [][]byte
+	var cumul []uint64
+	var total uint64
+	scanner := bufio.NewScanner(f)
+	for ln := 1; scanner.Scan(); ln++ {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		word, weight := line, uint64(1)
+		if i := strings.LastIndexByte(line, '\t'); i >= 0 {
+			word = line[:i]
+			if weight, err = strconv.ParseUint(strings.TrimSpace(line[i+1:]), 10, 64); err != nil {
+				panic(fmt.Sprintf("%s, line %d : invalid weight", fName, ln))
+			}
+		}
+		if weight == 0 {
+			continue
+		}
+		if total+weight < total || total+weight >= 1<<56 {
+			panic(fmt.Sprintf("%s, line %d : total weight reaches 2^56", fName, ln))
+		}
+		total += weight
+		words = append(words, []byte(word))
+		cumul = append(cumul, total)
+	}
+	if err = scanner.Err(); err != nil {
+		panic(err)
+	}
+	if len(words) == 0 {
+		panic("the weighted word list is empty")
+	}
+
+	mod := new(rmodule)
+	mod.signature = fmt.Sprintf("CompileWeightedWordList with %d words, total weight %d", len(words), total)
+	prev := uint64(0)
+	for _, c := range cumul {
+		mod.classes = append(mod.classes, pclass{p: float64(c-prev) / float64(total), n: 1})
+		prev = c
+	}
+	mod.classes = compactClasses(mod.classes)
+	mod.bytes = entropyBytes(float64(total))
+	mod.values = func(yield func(v []byte, q float64)) {
+		prev := uint64(0)
+		for i, c := range cumul {
+			yield(words[i], float64(c-prev)/float64(total))
+			prev = c
+		}
+	}
+
+	mod.run = func(d *drawer, p []byte) []byte {
+
+		// Select the weight
+		v := d.draw(total)
+
+		// find the word whose cumulated weight range contains v
+		i := sort.Search(len(cumul), func(i int) bool { return cumul[i] > v })
+
+		// append selected word
+		return append(p, words[i]...)
+	}
+
+	// append the module
+	r.rms = append(r.rms, mod)
+
+	return r
+}
+
+// WeightedTransform is a password transformation, with its weight.
+// A nil Transform leaves the password unchanged.
+type WeightedTransform struct {
+	Weight    float64
+	Transform func(p []byte) []byte
+}
+
+// CompileWeightedTransform compiles the password transformation,
+// selecting one among all transformations, with a probability
+// proportional to its weight. Weights need not sum to 1, and
+// are resolved to 1/2^32. Unlike CompileTransform, probabilities are not
+// limited to ratios of small integers, and the weights are part of the
+// signature.
+func (r *Rainbow) CompileWeightedTransform(wt ...WeightedTransform) *Rainbow {
+
+	if len(wt) == 0 {
+		panic("there should be at least one transformation, possibly nil")
+	}
+	var total float64
+	weights := make([]float64, len(wt))
+	trf := make([]func(p []byte) []byte, len(wt))
+	for i, w := range wt {
+		if w.Weight < 0 || math.IsInf(w.Weight, 0) || math.IsNaN(w.Weight) {
+			panic("transformation weights should be positive numbers")
+		}
+		total += w.Weight
+		weights[i], trf[i] = w.Weight, w.Transform
+	}
+	if total <= 0 {
+		panic("at least one transformation weight should be positive")
+	}
+
+	// cumulated weights, scaled to 2^32
+	cumul := make([]uint64, len(wt))
+	var sum float64
+	for i, w := range weights {
+		sum += w
+		cumul[i] = uint64(math.Round(sum / total * (1 << 32)))
+	}
+	cumul[len(cumul)-1] = 1 << 32
+
+	mod := new(rmodule)
+	mod.signature = fmt.Sprintf("CompileWeightedTransform with %d transformations, weights %v", len(wt), weights)
+	mod.bytes = 4
+	probs := make([]float64, len(wt))
+	for i, w := range weights {
+		probs[i] = w / total
+	}
+	mod.classes = transformClasses(trf, probs)
+	mod.run = func(d *drawer, p []byte) []byte {
+		// decide on transformation to use
+		v := d.draw(1 << 32)
+		i := sort.Search(len(cumul), func(i int) bool { return cumul[i] > v })
+
+		// transform if selection is not nil
+		if trf[i] != nil {
+			p = trf[i](p)
+		}
+		return p
+	}
+
+	// add the module
+	r.rms = append(r.rms, mod)
+
+	return r
+}
+
+// transformClasses computes the output classes of a transform module,
+// selecting trf[i] with probability probs[i], or uniformly if probs is nil.
+// Non nil transformations are assumed to produce distinct passwords,
+// while nil ones all leave it unchanged.
+func transformClasses(trf []func(p []byte) []byte, probs []float64) []pclass {
+	var classes []pclass
+	var unchanged float64
+	for i, t := range trf {
+		q := 1 / float64(len(trf))
+		if probs != nil {
+			q = probs[i]
+		}
+		switch {
+		case q == 0:
+		case t == nil:
+			unchanged += q
+		default:
+			classes = append(classes, pclass{p: q, n: 1})
+		}
+	}
+	if unchanged > 0 {
+		classes = append(classes, pclass{p: unchanged, n: 1})
+	}
+	return compactClasses(classes)
+}
@@ -0,0 +1,35 @@
+package rainbow
+
+import (
+	"crypto"
+	"math/rand"
+	"testing"
+)
+
+func TestCompileWeightedWordList(t *testing.T) {
+	r := New(crypto.MD5, 10).CompileWeightedWordList("weighted_words_test.txt")
+	mod := r.rms[0]
+	if mod.bytes != 1 {
+		t.Fatalf("expected %d byte of entropy, got %d", 1, mod.bytes)
+	}
+
+	// frequencies are proportional to weights
+	weights := map[string]float64{"password": 50, "123456": 30, "qwerty": 15, "letmein": 5, "monkey": 1}
+	counts := make(map[string]float64)
+	rd := rand.New(rand.NewSource(42))
+	ent := make([]byte, mod.bytes+entropySlack)
+	const n = 101_000
+	for i := 0; i < n; i++ {
+		rd.Read(ent)
+		counts[string(runModule(mod, ent, nil))]++
+	}
+	if len(counts) != len(weights) {
+		t.Fatalf("unexpected words selected : %v", counts)
+	}
+	for w, wt := range weights {
+		expected := n * wt / 101
+		if d := counts[w] - expected; d > 0.1*expected+50 || d < -0.1*expected-50 {
+			t.Fatalf("word %q selected %v times, expected about %v", w, counts[w], expected)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package rainbow
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+)
+
+// Word index file layout, integers are little endian uint64 unless noted :
+//
+//	magic "RBWI", version as uint32
+//	flags, bit 0 set when words were read one per line,
+//	bit 1 set when words were normalized to NFC
+//	count, the number of words
+//	digest, 8 bytes, as recorded in the word list signature
+//	size, of the word data
+//	count+1 offsets, the first being 0, the last being size
+//	word data
+//
+// Word i is data[offset i : offset i+1].
+
+// word index file magic, and format version
+const (
+	wordIndexMagic   = "RBWI"
+	wordIndexVersion = 1
+)
+
+// size of the word index header
+const wordIndexHeaderSize = 40
+
+// WriteWordIndex reads a word list from reader, like CompileWordListFrom
+// does with the same options, and writes it to w as a word index,
+// to be memory mapped by CompileWordIndex.
+func WriteWordIndex(w io.Writer, reader io.Reader, opt WordListOptions) error {
+	words, err := readWords(reader, opt)
+	if err != nil {
+		return err
+	}
+	header := make([]byte, wordIndexHeaderSize)
+	copy(header, wordIndexMagic)
+	mode.PutUint32(header[4:], wordIndexVersion)
+	var flags uint64
+	if opt.Lines {
+		flags |= 1
+	}
+	if words.nfc {
+		flags |= 2
+	}
+	mode.PutUint64(header[8:], flags)
+	mode.PutUint64(header[16:], uint64(words.len()))
+	copy(header[24:32], words.digest())
+	mode.PutUint64(header[32:], uint64(len(words.data)))
+
+	buf := bufio.NewWriter(w)
+	buf.Write(header)
+	b := make([]byte, 8)
+	for _, o := range words.offsets {
+		mode.PutUint64(b, o)
+		buf.Write(b)
+	}
+	buf.Write(words.data)
+	return buf.Flush()
+}
+
+// CompileWordIndex is like CompileWordListFile, reading the word list
+// from a word index written by WriteWordIndex. The file is memory mapped
+// when the platform allows it, for the life of the process, so huge word
+// lists neither need to be parsed, nor to fit in memory. The signature is
+// the same as the signature of the word list it was built from.
+func (r *Rainbow) CompileWordIndex(fName string) *Rainbow {
+	words, digest, lines, err := openWordIndex(fName)
+	if err != nil {
+		panic(err)
+	}
+	return r.compileWords(words, digest, lines)
+}
+
+// openWordIndex maps a word index, checking its consistency.
+func openWordIndex(fName string) (words *wordArena, digest []byte, lines bool, err error) {
+	f, err := os.Open(fName)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, nil, false, err
+	}
+	fsize := uint64(fi.Size())
+	if fsize < wordIndexHeaderSize+8 {
+		return nil, nil, false, errorf(ErrTruncated, "%s", fName)
+	}
+	data, err := mmapFile(f, int(fsize))
+	if err != nil {
+		return nil, nil, false, err
+	}
+	if words, err = checkWordIndex(data); err != nil {
+		munmapFile(data)
+		return nil, nil, false, errorf(err, "%s", fName)
+	}
+	return words, data[24:32], mode.Uint64(data[8:])&1 != 0, nil
+}
+
+// checkWordIndex checks the content of a word index file.
+func checkWordIndex(data []byte) (*wordArena, error) {
+	switch {
+	case !bytes.Equal(data[:4], []byte(wordIndexMagic)):
+		return nil, errorf(ErrBadMagic, "not a word index")
+	case mode.Uint32(data[4:]) != wordIndexVersion:
+		return nil, errorf(ErrBadVersion, "word index version %d", mode.Uint32(data[4:]))
+	}
+	count, size := mode.Uint64(data[16:]), mode.Uint64(data[32:])
+	rest := uint64(len(data) - wordIndexHeaderSize)
+	switch {
+	case count >= rest/8 || size > rest:
+		return nil, errorf(ErrBadHeader, "invalid count or size")
+	case (count+1)*8+size < rest:
+		return nil, errorf(ErrCountMismatch, "trailing data")
+	case (count+1)*8+size > rest:
+		return nil, errorf(ErrTruncated, "missing data")
+	}
+	words := &wordArena{index: data[wordIndexHeaderSize : wordIndexHeaderSize+(count+1)*8]}
+	words.nfc = mode.Uint64(data[8:])&2 != 0
+	words.data = data[wordIndexHeaderSize+(count+1)*8:]
+	last := uint64(0)
+	for i := 0; i <= int(count); i++ {
+		o := mode.Uint64(words.index[8*i:])
+		if o < last || (i == 0 && o != 0) || (i == int(count) && o != size) {
+			return nil, errorf(ErrCorrupted, "invalid offset for word %d", i)
+		}
+		last = o
+	}
+	return words, nil
+}
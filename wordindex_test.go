@@ -0,0 +1,54 @@
+package rainbow
+
+import (
+	"bytes"
+	"crypto"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWordIndex(t *testing.T) {
+	const list = "correct horse\nbattery staple\n\ntroubadour\ncorrect horse\n"
+	opt := WordListOptions{Lines: true, Dedup: true, NFC: true}
+	fname := filepath.Join(t.TempDir(), "words.rbwi")
+	buf := new(bytes.Buffer)
+	if e := WriteWordIndex(buf, strings.NewReader(list), opt); e != nil {
+		t.Fatal(e)
+	}
+	if e := os.WriteFile(fname, buf.Bytes(), 0644); e != nil {
+		t.Fatal(e)
+	}
+
+	// the index compiles to the same module as the word list
+	want := New(crypto.MD5, 10).CompileWordListFrom(strings.NewReader(list), opt).Build()
+	r := New(crypto.MD5, 10).CompileWordIndex(fname).Build()
+	if r.signature != want.signature {
+		t.Fatalf("signatures differ :\n%s\n%s", r.signature, want.signature)
+	}
+	counts := sample(r, 3_000)
+	checkDistribution(t, "word index", counts, map[string]float64{"correct horse": 1. / 3, "battery staple": 1. / 3, "troubadour": 1. / 3}, 3_000)
+
+	good := buf.Bytes()
+	for _, c := range []struct {
+		name string
+		data []byte
+		err  error
+	}{
+		{"magic", append([]byte("RBWX"), good[4:]...), ErrBadMagic},
+		{"version", append(append([]byte{}, good[:4]...), append([]byte{9, 0, 0, 0}, good[8:]...)...), ErrBadVersion},
+		{"truncated", good[:len(good)-1], ErrTruncated},
+		{"trailing", append(append([]byte{}, good...), 0), ErrCountMismatch},
+		{"count", append(append([]byte{}, good[:16]...), append([]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, good[24:]...)...), ErrBadHeader},
+		{"offsets", append(append([]byte{}, good[:48]...), append([]byte{0xff}, good[49:]...)...), ErrCorrupted},
+		{"short", good[:20], ErrTruncated},
+	} {
+		bad := filepath.Join(t.TempDir(), c.name)
+		os.WriteFile(bad, c.data, 0644)
+		if _, _, _, e := openWordIndex(bad); !errors.Is(e, c.err) {
+			t.Fatalf("%s : expected %v, got %v", c.name, c.err, e)
+		}
+	}
+}
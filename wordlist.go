@@ -0,0 +1,289 @@
+package rainbow
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"crypto/sha256"
+	"fmt"
+	"hash/maphash"
+	"io"
+	"io/fs"
+	"os"
+	"regexp"
+	"unicode/utf8"
+
+	"github.com/xavier268/go-rainbow/internal/zstd"
+	"golang.org/x/text/unicode/norm"
+)
+
+// WordListOptions controls how word lists are read, and preprocessed.
+// Words are normalized, then filtered, deduplicated, and finally
+// the list is cut to its first Top words.
+type WordListOptions struct {
+	// Lines reads one word per line, keeping embedded spaces,
+	// rather than space separated words. Empty lines are ignored.
+	Lines bool
+	// NFC normalizes words to Unicode normalization form C, so that
+	// accented letters are the same word, whether typed as a single rune
+	// or as a letter followed by combining accents.
+	NFC bool
+	// Normalize, if not nil, transforms each word, after NFC.
+	Normalize func(w []byte) []byte
+	// Lowercase converts words to lower case, after Normalize.
+	Lowercase bool
+	// MinLen and MaxLen, when positive, keep words of at least
+	// MinLen and at most MaxLen runes.
+	MinLen, MaxLen int
+	// Filter, if not nil, keeps words matching it.
+	Filter *regexp.Regexp
+	// Dedup keeps only the first occurrence of each word. Otherwise,
+	// duplicated words are selected more often.
+	Dedup bool
+	// Top, when positive, keeps the first Top words, such as the most
+	// frequent words of a list sorted by frequency.
+	Top int
+}
+
+// CompileWordList will load the word list from file,
+// store it in memory, and select one on every reduce operation,
+// that will be appended to the current password.
+// The words are listed in the provided file, space separated,
+// as per the ScanWords SplitFunction.
+// Compressed files are detected, see CompileWordListFrom.
+func (r *Rainbow) CompileWordList(fName string) *Rainbow {
+	return r.CompileWordListFile(fName, WordListOptions{})
+}
+
+// CompileWordListFile is like CompileWordList, with options.
+func (r *Rainbow) CompileWordListFile(fName string, opt WordListOptions) *Rainbow {
+	f, err := os.Open(fName)
+	if err != nil {
+		panic(err)
+	}
+	defer f.Close()
+	return r.CompileWordListFrom(f, opt)
+}
+
+// CompileWordListFS is like CompileWordListFile, reading the word list
+// from a file system, such as an embed.FS.
+func (r *Rainbow) CompileWordListFS(fsys fs.FS, name string, opt WordListOptions) *Rainbow {
+	f, err := fsys.Open(name)
+	if err != nil {
+		panic(err)
+	}
+	defer f.Close()
+	return r.CompileWordListFrom(f, opt)
+}
+
+// CompileWordListFrom is like CompileWordListFile, reading the word list
+// from reader. Lists compressed with gzip, bzip2 or zstd are detected
+// and decompressed.
+func (r *Rainbow) CompileWordListFrom(reader io.Reader, opt WordListOptions) *Rainbow {
+
+	// scan and store words in memory
+	words, err := readWords(reader, opt)
+	if err != nil {
+		panic(err)
+	}
+	return r.compileWords(words, words.digest(), opt.Lines)
+}
+
+// compileWords compiles a word list module, selecting one of words.
+// The digest identifies the words.
+func (r *Rainbow) compileWords(words *wordArena, digest []byte, lines bool) *Rainbow {
+	n := words.len()
+	if n == 0 {
+		panic("the word list is empty")
+	}
+
+	mod := new(rmodule)
+	mod.signature = fmt.Sprintf("CompileWordList with %d words, digest %x", n, digest)
+	if lines {
+		mod.signature += ", one per line"
+	}
+	if words.nfc {
+		mod.signature += ", NFC"
+	}
+	mod.classes = []pclass{{p: 1 / float64(n), n: float64(n)}}
+	mod.bytes = entropyBytes(float64(n))
+	mod.values = func(yield func(v []byte, q float64)) {
+		for i := 0; i < n; i++ {
+			yield(words.word(i), 1/float64(n))
+		}
+	}
+
+	mod.run = func(d *drawer, p []byte) []byte {
+
+		// Select the word
+		v := d.draw(uint64(n))
+
+		// append selected word
+		p = append(p, words.word(int(v))...)
+
+		// return
+		return p
+	}
+
+	// append the module
+	r.rms = append(r.rms, mod)
+
+	return r
+}
+
+// wordArena packs words in a single byte slice, rather than a slice
+// per word, to hold huge word lists : word i is data[offsets[i]:offsets[i+1]].
+// The offsets are either in memory, or little endian uint64 values
+// in index, for word lists mapped from an index file.
+type wordArena struct {
+	data    []byte
+	offsets []uint64
+	index   []byte
+	// were words normalized to NFC ?
+	nfc bool
+}
+
+// newWordArena returns an empty arena.
+func newWordArena() *wordArena {
+	return &wordArena{offsets: []uint64{0}}
+}
+
+// len is the number of words.
+func (a *wordArena) len() int {
+	if a.index != nil {
+		return len(a.index)/8 - 1
+	}
+	return len(a.offsets) - 1
+}
+
+// word returns word i. It should not be modified.
+func (a *wordArena) word(i int) []byte {
+	if a.index != nil {
+		return a.data[mode.Uint64(a.index[8*i:]):mode.Uint64(a.index[8*i+8:])]
+	}
+	return a.data[a.offsets[i]:a.offsets[i+1]]
+}
+
+// add appends a copy of w.
+func (a *wordArena) add(w []byte) {
+	a.data = append(a.data, w...)
+	a.offsets = append(a.offsets, uint64(len(a.data)))
+}
+
+// digest returns the first bytes of the SHA-256 of the words,
+// each followed by a new line, preceded by "NFC\n" for NFC words.
+func (a *wordArena) digest() []byte {
+	h := sha256.New()
+	if a.nfc {
+		h.Write([]byte("NFC\n"))
+	}
+	for i := 0; i < a.len(); i++ {
+		h.Write(a.word(i))
+		h.Write([]byte{'\n'})
+	}
+	return h.Sum(nil)[:8]
+}
+
+// wordSet records the words already seen, by hash, so that the words
+// are not stored twice. Words with the same hash as a different word
+// are kept in others.
+type wordSet struct {
+	words  *wordArena
+	hash   maphash.Hash
+	first  map[uint64]int
+	others map[string]bool
+}
+
+// seen reports whether w was seen before, or records it as word i.
+func (s *wordSet) seen(w []byte, i int) bool {
+	s.hash.Reset()
+	s.hash.Write(w)
+	h := s.hash.Sum64()
+	j, ok := s.first[h]
+	switch {
+	case !ok:
+		s.first[h] = i
+		return false
+	case bytes.Equal(s.words.word(j), w) || s.others[string(w)]:
+		return true
+	}
+	s.others[string(w)] = true
+	return false
+}
+
+// magic numbers of compressed word lists
+var (
+	gzipMagic  = []byte{0x1f, 0x8b}
+	bzip2Magic = []byte("BZh")
+	zstdMagic  = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// decompress returns a reader decompressing reader,
+// when its content is compressed.
+func decompress(reader io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(reader)
+	head, _ := br.Peek(4)
+	switch {
+	case bytes.HasPrefix(head, gzipMagic):
+		return gzip.NewReader(br)
+	case bytes.HasPrefix(head, bzip2Magic) && len(head) == 4 && head[3] >= '1' && head[3] <= '9':
+		return bzip2.NewReader(br), nil
+	case bytes.HasPrefix(head, zstdMagic):
+		return zstd.NewReader(br), nil
+	}
+	return br, nil
+}
+
+// maximum length of a word, or of a line with the Lines option,
+// beyond the 64 KiB default of bufio.Scanner
+const maxWordLen = 1 << 24
+
+// readWords reads the words of a word list, decompressing it if needed,
+// and preprocesses them. Words, or lines, longer than maxWordLen
+// fail with bufio.ErrTooLong.
+func readWords(reader io.Reader, opt WordListOptions) (*wordArena, error) {
+	reader, err := decompress(reader)
+	if err != nil {
+		return nil, err
+	}
+	words := newWordArena()
+	words.nfc = opt.NFC
+	set := &wordSet{words: words, first: make(map[uint64]int), others: make(map[string]bool)}
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(nil, maxWordLen)
+	if !opt.Lines {
+		scanner.Split(bufio.ScanWords)
+	}
+	for scanner.Scan() {
+		w := scanner.Bytes()
+		if opt.Lines {
+			if w = bytes.TrimSuffix(w, []byte("\r")); len(w) == 0 {
+				continue
+			}
+		}
+		if opt.NFC {
+			w = norm.NFC.Bytes(w)
+		}
+		if opt.Normalize != nil {
+			w = opt.Normalize(w)
+		}
+		if opt.Lowercase {
+			w = bytes.ToLower(w)
+		}
+		if n := utf8.RuneCount(w); (opt.MinLen > 0 && n < opt.MinLen) || (opt.MaxLen > 0 && n > opt.MaxLen) {
+			continue
+		}
+		if opt.Filter != nil && !opt.Filter.Match(w) {
+			continue
+		}
+		if opt.Dedup && set.seen(w, words.len()) {
+			continue
+		}
+		// the scanner reuses its buffer, words are copied to the arena
+		if words.add(w); words.len() == opt.Top {
+			break
+		}
+	}
+	return words, scanner.Err()
+}
@@ -0,0 +1,208 @@
+package rainbow
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"testing/iotest"
+)
+
+func TestWordListLines(t *testing.T) {
+	words, e := readWords(strings.NewReader("correct horse\nbattery staple\r\n\ntroubadour\n"), WordListOptions{Lines: true})
+	if e != nil {
+		t.Fatal(e)
+	}
+	if got := arenaWords(words); len(got) != 3 || got[0] != "correct horse" || got[1] != "battery staple" {
+		t.Fatalf("unexpected words %q", got)
+	}
+	words, _ = readWords(strings.NewReader("correct horse\nbattery staple\r\n\ntroubadour\n"), WordListOptions{})
+	if words.len() != 5 {
+		t.Fatalf("unexpected words %q", arenaWords(words))
+	}
+
+	// the signature records the mode, and the content
+	sig := New(crypto.MD5, 10).CompileWordListFile("lines_test.txt", WordListOptions{Lines: true}).rms[0].signature
+	if !strings.HasPrefix(sig, "CompileWordList with 3 words, digest ") || !strings.HasSuffix(sig, ", one per line") {
+		t.Fatalf("unexpected signature %q", sig)
+	}
+	other := New(crypto.MD5, 10).CompileWordListFrom(strings.NewReader("correct horse\nbattery staple\ntroubadours\n"), WordListOptions{Lines: true}).rms[0].signature
+	if other == sig {
+		t.Fatal("signatures should differ for word lists of the same size")
+	}
+}
+
+func TestWordListPreprocessing(t *testing.T) {
+	const list = "Password 123456 password PASSWORD été Été qwerty 12345678 dragon password"
+	for _, c := range []struct {
+		opt  WordListOptions
+		want string
+	}{
+		{WordListOptions{}, list},
+		{WordListOptions{Dedup: true}, "Password 123456 password PASSWORD été Été qwerty 12345678 dragon"},
+		{WordListOptions{Lowercase: true, Dedup: true}, "password 123456 été qwerty 12345678 dragon"},
+		{WordListOptions{MinLen: 3, MaxLen: 6}, "123456 été Été qwerty dragon"},
+		{WordListOptions{Filter: regexp.MustCompile(`^[0-9]+$`)}, "123456 12345678"},
+		{WordListOptions{Top: 3}, "Password 123456 password"},
+		{WordListOptions{Lowercase: true, Dedup: true, Top: 3}, "password 123456 été"},
+		{WordListOptions{Normalize: bytes.ToUpper, Dedup: true, MaxLen: 6}, "123456 ÉTÉ QWERTY DRAGON"},
+	} {
+		words, e := readWords(strings.NewReader(list), c.opt)
+		if e != nil {
+			t.Fatal(e)
+		}
+		if got := strings.Join(arenaWords(words), " "); got != c.want {
+			t.Fatalf("with %+v, expected %q, got %q", c.opt, c.want, got)
+		}
+	}
+
+	// duplicates are no longer favoured
+	r := New(crypto.MD5, 10).CompileWordListFrom(strings.NewReader("a a a b"), WordListOptions{Dedup: true})
+	checkDistribution(t, "dedup", sample(r, 10_000), map[string]float64{"a": 0.5, "b": 0.5}, 10_000)
+}
+
+func TestWordListNFC(t *testing.T) {
+	// é, as a single rune, then as e and a combining acute accent
+	const composed, decomposed = "\u00e9t\u00e9", "e\u0301te\u0301"
+	words, e := readWords(strings.NewReader(composed+" "+decomposed), WordListOptions{NFC: true, Dedup: true})
+	if e != nil {
+		t.Fatal(e)
+	}
+	if got := arenaWords(words); len(got) != 1 || got[0] != composed {
+		t.Fatalf("expected the composed word only, got %q", got)
+	}
+	words, _ = readWords(strings.NewReader(composed+" "+decomposed), WordListOptions{Dedup: true})
+	if words.len() != 2 {
+		t.Fatalf("without NFC, expected 2 words, got %q", arenaWords(words))
+	}
+
+	// the signature records the normalization
+	sig := func(list string, nfc bool) string {
+		return New(crypto.MD5, 10).CompileWordListFrom(strings.NewReader(list), WordListOptions{NFC: nfc}).rms[0].signature
+	}
+	if sig(composed, true) != sig(decomposed, true) {
+		t.Fatal("signatures should not depend on the Unicode form with NFC")
+	}
+	if sig(composed, false) == sig(decomposed, false) {
+		t.Fatal("signatures should differ without NFC")
+	}
+	if s := sig(composed, true); s == sig(composed, false) || !strings.HasSuffix(s, ", NFC") {
+		t.Fatalf("unexpected signature %q", s)
+	}
+}
+
+func TestWordListSources(t *testing.T) {
+	plain, e := os.ReadFile("lines_test.txt")
+	if e != nil {
+		t.Fatal(e)
+	}
+	gz := new(bytes.Buffer)
+	zw := gzip.NewWriter(gz)
+	zw.Write(plain)
+	zw.Close()
+
+	opt := WordListOptions{Lines: true}
+	want := New(crypto.MD5, 10).CompileWordListFile("lines_test.txt", opt).Build()
+	for name, r := range map[string]*Rainbow{
+		"bzip2":  New(crypto.MD5, 10).CompileWordListFile("lines_test.txt.bz2", opt),
+		"gzip":   New(crypto.MD5, 10).CompileWordListFrom(gz, opt),
+		"zstd":   New(crypto.MD5, 10).CompileWordListFile("lines_test.txt.zst", opt),
+		"reader": New(crypto.MD5, 10).CompileWordListFrom(bytes.NewReader(plain), opt),
+		"fs":     New(crypto.MD5, 10).CompileWordListFS(fstest.MapFS{"words.txt": {Data: plain}}, "words.txt", opt),
+	} {
+		r.Build()
+		if r.signature != want.signature {
+			t.Fatalf("%s : signature differs", name)
+		}
+		h := make([]byte, 16)
+		for i := 0; i < 100; i++ {
+			h[0] = byte(i)
+			if !bytes.Equal(r.rf(0, h, nil), want.rf(0, h, nil)) {
+				t.Fatalf("%s : reduce differs", name)
+			}
+		}
+	}
+
+	// compressed zstd blocks, of word0 to word999
+	plain = nil
+	for i := 0; i < 1000; i++ {
+		plain = append(plain, fmt.Sprintf("word%d\n", i)...)
+	}
+	want = New(crypto.MD5, 10).CompileWordListFrom(bytes.NewReader(plain), opt).Build()
+	if r := New(crypto.MD5, 10).CompileWordListFile("counting_test.txt.zst", opt).Build(); r.signature != want.signature {
+		t.Fatal("zstd : signature differs")
+	}
+
+	// corrupted zstd streams are rejected
+	defer func() {
+		if recover() == nil {
+			t.Fatal("corrupted zstd word lists should be rejected")
+		}
+	}()
+	New(crypto.MD5, 10).CompileWordListFrom(bytes.NewReader([]byte{0x28, 0xb5, 0x2f, 0xfd, 0, 0}), opt)
+}
+
+// arenaWords returns the words of a, as strings.
+func arenaWords(a *wordArena) []string {
+	var words []string
+	for i := 0; i < a.len(); i++ {
+		words = append(words, string(a.word(i)))
+	}
+	return words
+}
+
+// TestWordListLongInput reads many words, and a few long ones,
+// through readers returning small and irregular chunks, so that words
+// cross the scanner buffer boundaries, and buffers are refilled and grown.
+func TestWordListLongInput(t *testing.T) {
+	rd := rand.New(rand.NewSource(42))
+	var want []string
+	var sb strings.Builder
+	for i := 0; i < 50_000; i++ {
+		n := 1 + rd.Intn(20)
+		if i%10_000 == 5_000 {
+			// beyond the 64 KiB default limit of bufio.Scanner
+			n = 70_000 + rd.Intn(100_000)
+		}
+		w := make([]byte, n)
+		for j := range w {
+			w[j] = byte('a' + rd.Intn(26))
+		}
+		want = append(want, string(w))
+		sb.Write(w)
+		sb.WriteString("\n")
+	}
+	for name, reader := range map[string]io.Reader{
+		"plain":    strings.NewReader(sb.String()),
+		"one byte": iotest.OneByteReader(strings.NewReader(sb.String())),
+		"half":     iotest.HalfReader(strings.NewReader(sb.String())),
+	} {
+		words, e := readWords(reader, WordListOptions{Lines: true})
+		if e != nil {
+			t.Fatal(name, e)
+		}
+		got := arenaWords(words)
+		if len(got) != len(want) {
+			t.Fatalf("%s : expected %d words, got %d", name, len(want), len(got))
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Fatalf("%s : word %d differs", name, i)
+			}
+		}
+	}
+
+	// lines are limited to maxWordLen
+	if _, e := readWords(strings.NewReader(strings.Repeat("a", maxWordLen+1)), WordListOptions{Lines: true}); !errors.Is(e, bufio.ErrTooLong) {
+		t.Fatalf("expected %v, got %v", bufio.ErrTooLong, e)
+	}
+}